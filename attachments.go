@@ -0,0 +1,156 @@
+package keybasebot
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"samhofi.us/x/keybase/v2/types/chat1"
+)
+
+// AttachmentFilter describes which attachments a command is interested in. Empty fields
+// match everything
+type AttachmentFilter struct {
+	// MIME types to accept. These may contain glob patterns, such as "text/*"
+	MimeTypes []string
+
+	// Filename patterns to accept, such as "*.csv". Patterns are matched case-insensitively
+	// against the base name of the uploaded file
+	Filenames []string
+
+	// The largest file, in bytes, to accept. Zero means there is no limit
+	MaxSize int64
+}
+
+// AttachmentAction is like a BotAction, but also receives the downloaded attachment. The file
+// is closed and removed after the AttachmentAction returns
+type AttachmentAction func(m chat1.MsgSummary, file *os.File, b *Bot) (bool, error)
+
+// matchAny returns true if name matches any of the glob patterns, or if there are no
+// patterns
+func matchAny(patterns []string, name string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(strings.ToLower(pattern), strings.ToLower(name)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Match returns true if the message is an attachment that passes the filter. Attachments
+// that haven't finished uploading never match, since they can't be downloaded yet
+func (f AttachmentFilter) Match(m chat1.MsgSummary) bool {
+	if m.Content.TypeName != "attachment" || m.Content.Attachment == nil {
+		return false
+	}
+	if !m.Content.Attachment.Uploaded {
+		return false
+	}
+	asset := m.Content.Attachment.Object
+	if !matchAny(f.MimeTypes, asset.MimeType) {
+		return false
+	}
+	if !matchAny(f.Filenames, filepath.Base(asset.Filename)) {
+		return false
+	}
+	if f.MaxSize > 0 && asset.Size > f.MaxSize {
+		return false
+	}
+	return true
+}
+
+// downloadAttachment downloads the attachment in a message to a new temporary directory
+// inside Bot.TempDir, and returns the path to the downloaded file
+func (b *Bot) downloadAttachment(m chat1.MsgSummary) (string, error) {
+	dir, err := ioutil.TempDir(b.TempDir, "keybasebot-")
+	if err != nil {
+		return "", fmt.Errorf("unable to create temp directory: %w", err)
+	}
+
+	name := filepath.Base(m.Content.Attachment.Object.Filename)
+	if name == "." || name == string(filepath.Separator) {
+		name = "attachment"
+	}
+	file := filepath.Join(dir, name)
+
+	if _, err := b.KB.DownloadFromConversation(m.ConvID, m.Id, file); err != nil {
+		os.RemoveAll(dir)
+		return "", fmt.Errorf("unable to download attachment: %w", err)
+	}
+	return file, nil
+}
+
+// AttachmentPath returns the path to the downloaded attachment for a message. This is only
+// available to a BotAction that has been wrapped with the Attachment adapter, and only until
+// the BotAction returns
+func (b *Bot) AttachmentPath(m chat1.MsgSummary) (string, bool) {
+	p, ok := b.downloads.Load(msgKey{ConvID: m.ConvID, MsgID: m.Id})
+	if !ok {
+		return "", false
+	}
+	return p.(string), true
+}
+
+// Attachment returns an Adapter that only runs a command when the message is an attachment
+// that passes the filter. The attachment is downloaded to a temporary location before the
+// command runs, and the command can find it with Bot.AttachmentPath. The file is removed
+// after the command returns. Note that you do not need to use the MessageType adapter when
+// using this as we will already be checking to make sure the message is an attachment.
+func Attachment(filter AttachmentFilter) Adapter {
+	return func(botAction BotAction) BotAction {
+		return func(m chat1.MsgSummary, b *Bot) (bool, error) {
+			b.LoggerFor(m).Debug("Verifying message is a matching attachment")
+			if !filter.Match(m) {
+				b.LoggerFor(m).Debug("Message is not a matching attachment, exiting command")
+				return false, nil
+			}
+
+			b.LoggerFor(m).Debug("Downloading attachment '%s'", m.Content.Attachment.Object.Filename)
+			file, err := b.downloadAttachment(m)
+			if err != nil {
+				return true, b.LocalizedError(m, err, MsgAttachmentFailed)
+			}
+
+			key := msgKey{ConvID: m.ConvID, MsgID: m.Id}
+			b.downloads.Store(key, file)
+			defer func() {
+				b.downloads.Delete(key)
+				if err := os.RemoveAll(filepath.Dir(file)); err != nil {
+					b.LoggerFor(m).Error("Unable to clean up attachment '%s': %v", file, err)
+				}
+			}()
+
+			b.LoggerFor(m).Debug("Attachment downloaded to '%s', continuing", file)
+			return botAction(m, b)
+		}
+	}
+}
+
+// WithAttachment turns an AttachmentAction into a BotAction that only runs when the message
+// is an attachment that passes the filter. If the downloaded file is missing, the message is
+// treated as not matching
+func WithAttachment(filter AttachmentFilter, attachmentAction AttachmentAction) BotAction {
+	return Adapt(func(m chat1.MsgSummary, b *Bot) (bool, error) {
+		p, ok := b.AttachmentPath(m)
+		if !ok {
+			b.LoggerFor(m).Debug("Attachment for message %d was not downloaded, exiting command", m.Id)
+			return false, nil
+		}
+		file, err := os.Open(p)
+		if os.IsNotExist(err) {
+			b.LoggerFor(m).Debug("Attachment for message %d is missing, exiting command", m.Id)
+			return false, nil
+		}
+		if err != nil {
+			return true, b.LocalizedError(m, fmt.Errorf("unable to open attachment: %w", err), MsgAttachmentFailed)
+		}
+		defer file.Close()
+		return attachmentAction(m, file, b)
+	}, Attachment(filter))
+}
@@ -0,0 +1,49 @@
+package keybasebot
+
+import (
+	"testing"
+
+	"samhofi.us/x/keybase/v2/types/chat1"
+)
+
+func attachmentMsg(filename, mimeType string, size int64, uploaded bool) chat1.MsgSummary {
+	return chat1.MsgSummary{
+		Content: chat1.MsgContent{
+			TypeName: "attachment",
+			Attachment: &chat1.MessageAttachment{
+				Object: chat1.Asset{
+					Filename: filename,
+					MimeType: mimeType,
+					Size:     size,
+				},
+				Uploaded: uploaded,
+			},
+		},
+	}
+}
+
+func TestAttachmentFilterMatch(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter AttachmentFilter
+		msg    chat1.MsgSummary
+		want   bool
+	}{
+		{"empty filter", AttachmentFilter{}, attachmentMsg("a.txt", "text/plain", 10, true), true},
+		{"not uploaded", AttachmentFilter{}, attachmentMsg("a.txt", "text/plain", 10, false), false},
+		{"not an attachment", AttachmentFilter{}, chat1.MsgSummary{Content: chat1.MsgContent{TypeName: "text"}}, false},
+		{"mime glob", AttachmentFilter{MimeTypes: []string{"text/*"}}, attachmentMsg("a.txt", "text/csv", 10, true), true},
+		{"mime mismatch", AttachmentFilter{MimeTypes: []string{"image/*"}}, attachmentMsg("a.txt", "text/csv", 10, true), false},
+		{"filename case", AttachmentFilter{Filenames: []string{"*.csv"}}, attachmentMsg("/tmp/DATA.CSV", "text/csv", 10, true), true},
+		{"filename mismatch", AttachmentFilter{Filenames: []string{"*.csv"}}, attachmentMsg("data.txt", "text/plain", 10, true), false},
+		{"size limit", AttachmentFilter{MaxSize: 5}, attachmentMsg("a.txt", "text/plain", 10, true), false},
+		{"size ok", AttachmentFilter{MaxSize: 10}, attachmentMsg("a.txt", "text/plain", 10, true), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.Match(tt.msg); got != tt.want {
+				t.Errorf("Match() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package keybasebot
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// chatAPIRequest is the format of a request sent to the Keybase chat API
+type chatAPIRequest struct {
+	Method string `json:"method"`
+	Params struct {
+		Options interface{} `json:"options"`
+	} `json:"params"`
+}
+
+// chatAPIResponse is the format of a response received from the Keybase chat API
+type chatAPIResponse struct {
+	Result json.RawMessage `json:"result"`
+	Error  *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+// chatAPI sends a request directly to the Keybase chat API. This is used for the few methods
+// that the keybase library doesn't wrap. If result is not nil, the result of the request
+// will be unmarshaled into it
+func (b *Bot) chatAPI(method string, options interface{}, result interface{}) error {
+	var req chatAPIRequest
+	req.Method = method
+	req.Params.Options = options
+
+	reqBytes, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("unable to marshal %s request: %w", method, err)
+	}
+
+	resBytes, err := b.KB.Exec("chat", "api", "-m", string(reqBytes))
+	if err != nil {
+		return fmt.Errorf("%s request failed: %w", method, err)
+	}
+
+	var res chatAPIResponse
+	if err := json.Unmarshal(resBytes, &res); err != nil {
+		return fmt.Errorf("unable to unmarshal %s response: %w", method, err)
+	}
+	if res.Error != nil {
+		return fmt.Errorf("%s request returned error %d: %s", method, res.Error.Code, res.Error.Message)
+	}
+	if result == nil {
+		return nil
+	}
+	if err := json.Unmarshal(res.Result, result); err != nil {
+		return fmt.Errorf("unable to unmarshal %s result: %w", method, err)
+	}
+	return nil
+}
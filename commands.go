@@ -1,7 +1,6 @@
 package keybasebot
 
 import (
-	"fmt"
 	"strings"
 
 	"github.com/kf5grd/keybasebot/pkg/util"
@@ -26,12 +25,12 @@ func Adapt(b BotAction, adapters ...Adapter) BotAction {
 func MessageType(typeName string) Adapter {
 	return func(botAction BotAction) BotAction {
 		return func(m chat1.MsgSummary, b *Bot) (bool, error) {
-			b.Logger.Debug("Verifying message type is '%s'", typeName)
+			b.LoggerFor(m).Debug("Verifying message type is '%s'", typeName)
 			if m.Content.TypeName != typeName {
-				b.Logger.Debug("Message type is '%s', exiting command", m.Content.TypeName)
+				b.LoggerFor(m).Debug("Message type is '%s', exiting command", m.Content.TypeName)
 				return false, nil
 			}
-			b.Logger.Debug("Message type is '%s', continuing", typeName)
+			b.LoggerFor(m).Debug("Message type is '%s', continuing", typeName)
 			return botAction(m, b)
 		}
 	}
@@ -43,12 +42,12 @@ func MessageType(typeName string) Adapter {
 func CommandPrefix(prefix string) Adapter {
 	return func(botAction BotAction) BotAction {
 		return func(m chat1.MsgSummary, b *Bot) (bool, error) {
-			b.Logger.Debug("Verifying message contains prefix '%s'", prefix)
+			b.LoggerFor(m).Debug("Verifying message contains prefix '%s'", prefix)
 			if !strings.HasPrefix(m.Content.Text.Body, prefix) {
-				b.Logger.Debug("Message does not contain prefix '%s', exiting command", prefix)
+				b.LoggerFor(m).Debug("Message does not contain prefix '%s', exiting command", prefix)
 				return false, nil
 			}
-			b.Logger.Debug("Message does contain prefix '%s', continuing", prefix)
+			b.LoggerFor(m).Debug("Message does contain prefix '%s', continuing", prefix)
 			return botAction(m, b)
 		}
 	}
@@ -60,34 +59,56 @@ func CommandPrefix(prefix string) Adapter {
 func ReactionTrigger(trigger string) Adapter {
 	return func(botAction BotAction) BotAction {
 		return func(m chat1.MsgSummary, b *Bot) (bool, error) {
-			b.Logger.Debug("Verifying message type is 'reaction'")
+			b.LoggerFor(m).Debug("Verifying message type is 'reaction'")
 			if m.Content.TypeName != "reaction" {
-				b.Logger.Debug("Message type is '%s', exiting command", m.Content.TypeName)
+				b.LoggerFor(m).Debug("Message type is '%s', exiting command", m.Content.TypeName)
 				return false, nil
 			}
-			b.Logger.Debug("Verifying reaction body is '%s'", trigger)
+			b.LoggerFor(m).Debug("Verifying reaction body is '%s'", trigger)
 			if m.Content.Reaction.Body != trigger {
-				b.Logger.Debug("Reaction body is '%s', exiting command", m.Content.Reaction.Body)
+				b.LoggerFor(m).Debug("Reaction body is '%s', exiting command", m.Content.Reaction.Body)
 				return false, nil
 			}
-			b.Logger.Debug("Reaction body is '%s', continuing", m.Content.Reaction.Body)
+			b.LoggerFor(m).Debug("Reaction body is '%s', continuing", m.Content.Reaction.Body)
 			return botAction(m, b)
 		}
 	}
 }
 
 // MinRole returns an Adapter that restricts a command to users with _at least_ the
-// specified role. Note that this _must_ be called _after_ CommandPrefix because this
-// assumes that we already know we're executing the provided command.
+// specified role. In team conversations the user's team-level role is checked, so implicit
+// admins from parent teams and members who haven't joined the channel are handled
+// correctly. Note that this _must_ be called _after_ CommandPrefix because this assumes
+// that we already know we're executing the provided command.
 func MinRole(kb *keybase.Keybase, role string) Adapter {
 	return func(botAction BotAction) BotAction {
 		return func(m chat1.MsgSummary, b *Bot) (bool, error) {
-			b.Logger.Debug("Verifying user '%s' has minimum role '%s' in '%s'", m.Sender.Username, role, util.ChannelString(m.Channel))
-			if !util.HasMinRole(kb, role, m.Sender.Username, m.ConvID) {
-				b.Logger.Debug("User '%s' does not have minimum role '%s' in '%s', exiting command and replying with error", m.Sender.Username, role, util.ChannelString(m.Channel))
-				return true, fmt.Errorf("Your role must be at least %s to do that.", role)
+			b.LoggerFor(m).Debug("Verifying sender has minimum role '%s' in the conversation", role)
+			if !util.HasMinChannelRole(kb, role, m.Sender.Username, m.Channel, m.ConvID) {
+				b.LoggerFor(m).Debug("Sender does not have minimum role '%s' in the conversation, exiting command and replying with error", role)
+				return true, b.Errorf(m, MsgMinRole, role)
 			}
-			b.Logger.Debug("User '%s' has minimum role '%s' in '%s', continuing", m.Sender.Username, role, util.ChannelString(m.Channel))
+			b.LoggerFor(m).Debug("Sender has minimum role '%s' in the conversation, continuing", role)
+			return botAction(m, b)
+		}
+	}
+}
+
+// MinTeamRole returns an Adapter that restricts a command to users with _at least_ the
+// specified role in a specific team, regardless of which conversation the command was sent
+// in. Implicit admins from parent teams are treated as admins. Note that this _must_ be
+// called _after_ CommandPrefix because this assumes that we already know we're executing
+// the provided command.
+func MinTeamRole(kb *keybase.Keybase, role, team string) Adapter {
+	return func(botAction BotAction) BotAction {
+		return func(m chat1.MsgSummary, b *Bot) (bool, error) {
+			logger := b.LoggerFor(m).With("team", team)
+			logger.Debug("Verifying sender has minimum role '%s' in team", role)
+			if !util.HasMinTeamRole(kb, role, m.Sender.Username, team) {
+				logger.Debug("Sender does not have minimum role '%s' in team, exiting command and replying with error", role)
+				return true, b.Errorf(m, MsgMinTeamRole, team, role)
+			}
+			logger.Debug("Sender has minimum role '%s' in team, continuing", role)
 			return botAction(m, b)
 		}
 	}
@@ -97,12 +118,13 @@ func MinRole(kb *keybase.Keybase, role string) Adapter {
 func FromUser(user string) Adapter {
 	return func(botAction BotAction) BotAction {
 		return func(m chat1.MsgSummary, b *Bot) (bool, error) {
-			b.Logger.Debug("Verifying received message was sent by '%s'", user)
+			logger := b.LoggerFor(m).With("user", user)
+			logger.Debug("Verifying received message was sent by user")
 			if m.Sender.Username != user {
-				b.Logger.Debug("Received message was sent by '%s', exiting command", m.Sender.Username)
+				logger.Debug("Received message was sent by someone else, exiting command")
 				return false, nil
 			}
-			b.Logger.Debug("Received message was sent by '%s', continuing", user)
+			logger.Debug("Received message was sent by user, continuing")
 			return botAction(m, b)
 		}
 	}
@@ -113,12 +135,13 @@ func FromUser(user string) Adapter {
 func FromUsers(users []string) Adapter {
 	return func(botAction BotAction) BotAction {
 		return func(m chat1.MsgSummary, b *Bot) (bool, error) {
-			b.Logger.Debug("Verifying received message was sent by one of '%s'", strings.Join(users, ","))
+			logger := b.LoggerFor(m).With("users", strings.Join(users, ","))
+			logger.Debug("Verifying received message was sent by one of users")
 			if !util.StringInSlice(m.Sender.Username, users) {
-				b.Logger.Debug("Received message was sent by '%s', exiting command", m.Sender.Username)
+				logger.Debug("Received message was sent by someone else, exiting command")
 				return false, nil
 			}
-			b.Logger.Debug("Received message was sent by '%s', continuing", m.Sender.Username)
+			logger.Debug("Received message was sent by one of users, continuing")
 			return botAction(m, b)
 		}
 	}
@@ -130,7 +153,7 @@ func FromUsers(users []string) Adapter {
 func Contains(s string, ignoreCase bool, ignoreWhiteSpace bool) Adapter {
 	return func(botAction BotAction) BotAction {
 		return func(m chat1.MsgSummary, b *Bot) (bool, error) {
-			b.Logger.Debug("Verifying message contains '%s'", s)
+			b.LoggerFor(m).Debug("Verifying message contains '%s'", s)
 			var body string
 
 			switch m.Content.TypeName {
@@ -139,7 +162,7 @@ func Contains(s string, ignoreCase bool, ignoreWhiteSpace bool) Adapter {
 			case "edit":
 				body = m.Content.Edit.Body
 			default:
-				b.Logger.Debug("Received message does not have type 'text' or 'edit', exiting command")
+				b.LoggerFor(m).Debug("Received message does not have type 'text' or 'edit', exiting command")
 				return false, nil
 			}
 
@@ -153,10 +176,10 @@ func Contains(s string, ignoreCase bool, ignoreWhiteSpace bool) Adapter {
 				s = strings.Join(strings.Fields(s), "")
 			}
 			if !strings.Contains(body, s) {
-				b.Logger.Debug("Message does not contain '%s', exiting command", s)
+				b.LoggerFor(m).Debug("Message does not contain '%s', exiting command", s)
 				return false, nil
 			}
-			b.Logger.Debug("Message does contain '%s', continuing", s)
+			b.LoggerFor(m).Debug("Message does contain '%s', continuing", s)
 			return botAction(m, b)
 		}
 	}
@@ -0,0 +1,238 @@
+package keybasebot
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/shlex"
+	"github.com/kf5grd/keybasebot/pkg/logr"
+	"samhofi.us/x/keybase/v2"
+	"samhofi.us/x/keybase/v2/types/chat1"
+)
+
+// Context bundles everything a command needs while it handles a single message. Its helpers
+// send everything through the Bot, so replies are rate limited, tracked, and counted in the
+// same way as replies sent with Bot.Reply
+type Context struct {
+	// The message that triggered the command
+	Message chat1.MsgSummary
+
+	// The Bot handling the message
+	Bot *Bot
+
+	// The logger to use while handling the message
+	Logger *logr.Logger
+
+	// The command handling the message. This is nil if the Context was created outside of
+	// the bot's command loop
+	Command *BotCommand
+
+	// The words of a text message, split the same way a shell would split them, so quoted
+	// strings are kept together. Like os.Args, Args[0] is the command itself
+	Args []string
+
+	// Cancelled when the bot shuts down. Long-running commands should watch this so they
+	// can stop early
+	Ctx context.Context
+
+	// The most recent reply sent with Reply
+	lastReply *chat1.MessageID
+}
+
+// ContextAction is like a BotAction, but receives a Context instead of the message and the
+// Bot
+type ContextAction func(*Context) (bool, error)
+
+// splitArgs splits the body of a text message into arguments. If the body can't be split
+// like a shell would (e.g. because of an unterminated quote), it is split on whitespace
+func splitArgs(m chat1.MsgSummary) []string {
+	if m.Content.Text == nil {
+		return []string{}
+	}
+	args, err := shlex.Split(m.Content.Text.Body)
+	if err != nil {
+		return strings.Fields(m.Content.Text.Body)
+	}
+	return args
+}
+
+// NewContext returns a new Context for a message
+func (b *Bot) NewContext(m chat1.MsgSummary) *Context {
+	return &Context{
+		Message: m,
+		Bot:     b,
+		Logger:  b.LoggerFor(m),
+		Command: b.currentCommand(m),
+		Args:    splitArgs(m),
+		Ctx:     b.Ctx(),
+	}
+}
+
+// WithContext turns a ContextAction into a BotAction
+func WithContext(contextAction ContextAction) BotAction {
+	return func(m chat1.MsgSummary, b *Bot) (bool, error) {
+		return contextAction(b.NewContext(m))
+	}
+}
+
+// TraceID returns the trace ID of the message being handled. See Bot.TraceID
+func (c *Context) TraceID() string {
+	return c.Bot.TraceID(c.Message)
+}
+
+// Arg returns the argument at index i, or an empty string if there aren't that many
+// arguments
+func (c *Context) Arg(i int) string {
+	if i < 0 || i >= len(c.Args) {
+		return ""
+	}
+	return c.Args[i]
+}
+
+// Reply sends a reply to the message. See Bot.Reply
+func (c *Context) Reply(message string, a ...interface{}) (chat1.SendRes, error) {
+	res, err := c.Bot.Reply(c.Message, message, a...)
+	if err == nil && res.MessageID != nil {
+		id := *res.MessageID
+		c.lastReply = &id
+	}
+	return res, err
+}
+
+// ReplyPrivately sends a message to the sender in a private conversation between the bot
+// and the sender, instead of replying in the conversation the message was sent in. If the
+// command has BotCommand.Ephemeral set, the message explodes
+func (c *Context) ReplyPrivately(message string, a ...interface{}) (chat1.SendRes, error) {
+	var (
+		b       = c.Bot
+		body    = fmt.Sprintf(message, a...)
+		channel = chat1.ChatChannel{
+			Name:        fmt.Sprintf("%s,%s", b.KB.Username, c.Message.Sender.Username),
+			MembersType: keybase.USER,
+		}
+		conv = chat1.ConvIDStr("dm:" + channel.Name)
+		send = func() (chat1.SendRes, error) {
+			return b.send(conv, "private reply", b.TraceID(c.Message), func() (chat1.SendRes, error) {
+				return b.KB.SendMessageByChannel(channel, "%s", body)
+			})
+		}
+	)
+	if lifetime := b.replyLifetime(c.Message); lifetime > 0 {
+		opts := keybase.SendMessageOptions{
+			Channel:           channel,
+			Message:           keybase.SendMessageBody{Body: body},
+			ExplodingLifetime: &keybase.ExplodingLifetime{Duration: lifetime},
+		}
+		return b.sendExploding(c.Message, conv, "private reply", opts, send)
+	}
+	return send()
+}
+
+// React sends a reaction to the message. See Bot.React
+func (c *Context) React(reaction string) (chat1.SendRes, error) {
+	return c.Bot.React(c.Message, reaction)
+}
+
+// EditLastReply edits the most recent reply sent with Reply. If no reply has been sent yet,
+// a new reply is sent instead
+func (c *Context) EditLastReply(message string, a ...interface{}) (chat1.SendRes, error) {
+	if c.lastReply == nil {
+		return c.Reply(message, a...)
+	}
+
+	var (
+		b     = c.Bot
+		m     = c.Message
+		reply = *c.lastReply
+		body  = fmt.Sprintf(message, a...)
+	)
+	return b.send(m.ConvID, "edit", b.TraceID(c.Message), func() (chat1.SendRes, error) {
+		return b.KB.EditByConvID(m.ConvID, reply, "%s", body)
+	})
+}
+
+// DeleteLastReply deletes the most recent reply sent with Reply
+func (c *Context) DeleteLastReply() error {
+	if c.lastReply == nil {
+		return fmt.Errorf("no reply has been sent")
+	}
+
+	var (
+		b     = c.Bot
+		m     = c.Message
+		reply = *c.lastReply
+	)
+	_, err := b.send(m.ConvID, "delete", b.TraceID(c.Message), func() (chat1.SendRes, error) {
+		return b.KB.DeleteByConvID(m.ConvID, reply)
+	})
+	if err == nil {
+		c.lastReply = nil
+	}
+	return err
+}
+
+// Delete deletes the message that triggered the command. The bot must have permission to
+// delete other users' messages in the conversation
+func (c *Context) Delete() error {
+	var (
+		b = c.Bot
+		m = c.Message
+	)
+	_, err := b.send(m.ConvID, "delete", b.TraceID(c.Message), func() (chat1.SendRes, error) {
+		return b.KB.DeleteByConvID(m.ConvID, m.Id)
+	})
+	return err
+}
+
+// Upload uploads a file to the conversation the message was sent in. Like Bot.ReplyFile,
+// this returns ErrExplodingNotAllowed for commands with BotCommand.Ephemeral set, unless
+// Bot.EphemeralFallback is set
+func (c *Context) Upload(filename, title string) (chat1.SendRes, error) {
+	var (
+		b = c.Bot
+		m = c.Message
+	)
+	if err := b.checkUpload(m); err != nil {
+		return chat1.SendRes{}, err
+	}
+	res, err := b.send(m.ConvID, "upload", b.TraceID(c.Message), func() (chat1.SendRes, error) {
+		return b.KB.UploadToConversation(m.ConvID, title, filename)
+	})
+	if err == nil && res.MessageID != nil {
+		b.replies.add(msgKey{ConvID: m.ConvID, MsgID: m.Id}, *res.MessageID)
+	}
+	return res, err
+}
+
+// ReplyLong sends a reply that may be too long for a single message. See Bot.ReplyLong
+func (c *Context) ReplyLong(body string, opts LongReplyOptions) error {
+	return c.Bot.ReplyLong(c.Message, body, opts)
+}
+
+// ReplyTemplate renders a template and sends it as a reply. See Bot.ReplyTemplate
+func (c *Context) ReplyTemplate(name string, data interface{}) (chat1.SendRes, error) {
+	return c.Bot.ReplyTemplate(c.Message, name, data)
+}
+
+// Parent returns the message that the message was a reply to. See Bot.ParentMessage
+func (c *Context) Parent() (chat1.MsgSummary, error) {
+	return c.Bot.ParentMessage(c.Message)
+}
+
+// AttachmentPath returns the path to the message's downloaded attachment. See
+// Bot.AttachmentPath
+func (c *Context) AttachmentPath() (string, bool) {
+	return c.Bot.AttachmentPath(c.Message)
+}
+
+// T returns a translated message for the sender. See Bot.T
+func (c *Context) T(key string, a ...interface{}) string {
+	return c.Bot.T(c.Message, key, a...)
+}
+
+// StartProgress sends a placeholder reply that can be updated while the command works. See
+// Bot.StartProgress
+func (c *Context) StartProgress(text string) (*Progress, error) {
+	return c.Bot.StartProgress(c.Message, text)
+}
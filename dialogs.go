@@ -0,0 +1,377 @@
+package keybasebot
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kf5grd/keybasebot/pkg/kvstore"
+	"github.com/kf5grd/keybasebot/pkg/logr"
+	"samhofi.us/x/keybase/v2/types/chat1"
+)
+
+// DefaultDialogNamespace is the kvstore namespace used to persist pending dialogs when
+// Bot.DialogNamespace is not changed
+const DefaultDialogNamespace = "keybasebot-dialogs"
+
+// DefaultDialogTimeout is how long a dialog waits for an answer when Dialog.Timeout is not
+// set
+const DefaultDialogTimeout = 5 * time.Minute
+
+// DialogStep is a single question asked by a Dialog
+type DialogStep struct {
+	// The key the answer will be stored under in the answers passed to Dialog.OnComplete
+	Key string
+
+	// The question to ask
+	Prompt string
+
+	// Validate is optional, and is called with the user's answer. If it returns an error,
+	// the error is sent to the user and the question is asked again
+	Validate func(answer string) error
+}
+
+// DialogFunc is called when a Dialog is finished. The message is the one containing the
+// answer to the last question, and answers holds every answer keyed by DialogStep.Key. If
+// an error is returned, it will be sent back to the chat as a reply
+type DialogFunc func(m chat1.MsgSummary, answers map[string]string, b *Bot) error
+
+// Dialog is a series of questions the bot asks a single user in a single conversation.
+// While a dialog is waiting for an answer, the user's messages in that conversation are
+// handled by the dialog instead of being passed to the bot's commands
+type Dialog struct {
+	// The name the dialog is started with by Bot.StartDialog
+	Name string
+
+	// The questions to ask, in order
+	Steps []DialogStep
+
+	// How long to wait for each answer before giving up. Defaults to DefaultDialogTimeout
+	Timeout time.Duration
+
+	// Answers that cancel the dialog. These are matched case-insensitively. Defaults to
+	// "cancel"
+	CancelWords []string
+
+	// Called with all of the answers once the last question has been answered
+	OnComplete DialogFunc
+}
+
+// pendingDialog holds the state of a dialog that is waiting for an answer. This is what gets
+// persisted to the kvstore
+type pendingDialog struct {
+	Dialog  string             `json:"dialog"`
+	ConvID  chat1.ConvIDStr    `json:"conv_id"`
+	Channel *chat1.ChatChannel `json:"channel,omitempty"`
+	User    string             `json:"user"`
+	Step    int                `json:"step"`
+	Answers map[string]string  `json:"answers"`
+	Expires time.Time          `json:"expires"`
+
+	timer *time.Timer
+}
+
+// next returns a copy of the pending dialog that has moved on to the next step with the
+// given answer. Pending dialogs are never changed once they have been stored, so they can be
+// read without holding the dialogManager's lock
+func (p *pendingDialog) next(key, answer string) *pendingDialog {
+	n := &pendingDialog{
+		Dialog:  p.Dialog,
+		ConvID:  p.ConvID,
+		Channel: p.Channel,
+		User:    p.User,
+		Step:    p.Step + 1,
+		Answers: make(map[string]string, len(p.Answers)+1),
+	}
+	for k, v := range p.Answers {
+		n.Answers[k] = v
+	}
+	n.Answers[key] = answer
+	return n
+}
+
+// dialogKey identifies the pending dialog for a user in a conversation
+type dialogKey struct {
+	ConvID chat1.ConvIDStr
+	User   string
+}
+
+func (k dialogKey) String() string {
+	return fmt.Sprintf("%s:%s", k.ConvID, k.User)
+}
+
+// parseDialogKey parses a key created by dialogKey.String
+func parseDialogKey(s string) dialogKey {
+	i := strings.Index(s, ":")
+	if i < 0 {
+		return dialogKey{User: s}
+	}
+	return dialogKey{ConvID: chat1.ConvIDStr(s[:i]), User: s[i+1:]}
+}
+
+// logger returns a logger that identifies the user and conversation as fields, so they can
+// be hashed when Bot.HashLogIdentities is set
+func (k dialogKey) logger(b *Bot) *logr.Logger {
+	return b.Logger.WithFields(logr.Fields{"conv_id": k.ConvID, "sender": k.User})
+}
+
+// dialogManager keeps track of pending dialogs
+type dialogManager struct {
+	mu      sync.Mutex
+	pending map[dialogKey]*pendingDialog
+}
+
+func newDialogManager() *dialogManager {
+	return &dialogManager{
+		pending: make(map[dialogKey]*pendingDialog),
+	}
+}
+
+// dialog returns the registered Dialog with the given name
+func (b *Bot) dialog(name string) (*Dialog, bool) {
+	for i := range b.Dialogs {
+		if b.Dialogs[i].Name == name {
+			return &b.Dialogs[i], true
+		}
+	}
+	return nil, false
+}
+
+func (d *Dialog) timeout() time.Duration {
+	if d.Timeout > 0 {
+		return d.Timeout
+	}
+	return DefaultDialogTimeout
+}
+
+func (d *Dialog) isCancel(answer string) bool {
+	words := d.CancelWords
+	if len(words) == 0 {
+		words = []string{"cancel"}
+	}
+	for _, word := range words {
+		if strings.EqualFold(strings.TrimSpace(answer), word) {
+			return true
+		}
+	}
+	return false
+}
+
+// StartDialog starts the named dialog with the sender of m, in the conversation m was sent
+// in, and asks the first question. Any dialog that was already pending for that user in
+// that conversation is replaced
+func (b *Bot) StartDialog(m chat1.MsgSummary, name string) error {
+	d, ok := b.dialog(name)
+	if !ok {
+		return fmt.Errorf("unknown dialog '%s'", name)
+	}
+	if len(d.Steps) == 0 {
+		return fmt.Errorf("dialog '%s' has no steps", name)
+	}
+
+	p := &pendingDialog{
+		Dialog:  name,
+		ConvID:  m.ConvID,
+		Channel: &m.Channel,
+		User:    m.Sender.Username,
+		Answers: make(map[string]string),
+	}
+	b.LoggerFor(m).With("dialog", name).Debug("Starting dialog")
+	b.setPendingDialog(p, d)
+	_, err := b.Reply(m, "%s", d.Steps[0].Prompt)
+	return err
+}
+
+// CancelDialog cancels any pending dialog for the given user in the given conversation
+func (b *Bot) CancelDialog(conv chat1.ConvIDStr, user string) {
+	b.removePendingDialog(dialogKey{ConvID: conv, User: strings.ToLower(user)})
+}
+
+// setPendingDialog stores a pending dialog, starts its timeout, and persists it if dialog
+// persistence is enabled
+func (b *Bot) setPendingDialog(p *pendingDialog, d *Dialog) {
+	b.storePendingDialog(p, d, nil)
+}
+
+// storePendingDialog stores a pending dialog like setPendingDialog. If replace is not nil,
+// the dialog is only stored if replace is still the pending dialog for the user, so a dialog
+// that was cancelled or timed out in the meantime isn't brought back. It returns true if the
+// dialog was stored
+func (b *Bot) storePendingDialog(p *pendingDialog, d *Dialog, replace *pendingDialog) bool {
+	key := dialogKey{ConvID: p.ConvID, User: strings.ToLower(p.User)}
+	if p.Expires.IsZero() || p.Expires.Before(time.Now()) {
+		p.Expires = time.Now().Add(d.timeout())
+	}
+
+	b.dialogs.mu.Lock()
+	old, ok := b.dialogs.pending[key]
+	if replace != nil && (!ok || old != replace) {
+		b.dialogs.mu.Unlock()
+		return false
+	}
+	if ok && old.timer != nil {
+		old.timer.Stop()
+	}
+	p.timer = time.AfterFunc(time.Until(p.Expires), func() {
+		b.expireDialog(key, p)
+	})
+	b.dialogs.pending[key] = p
+	b.dialogs.mu.Unlock()
+
+	if b.PersistDialogs {
+		if err := kvstore.Put(b.KB, b.DialogTeam, b.DialogNamespace, kvstore.New(key.String(), p, -1)); err != nil {
+			key.logger(b).With("dialog", p.Dialog).Error("Unable to persist dialog: %v", err)
+		}
+	}
+	return true
+}
+
+// removePendingDialog forgets a pending dialog
+func (b *Bot) removePendingDialog(key dialogKey) {
+	b.removePendingDialogIf(key, nil)
+}
+
+// removePendingDialogIf forgets a pending dialog like removePendingDialog. If expect is not
+// nil, the dialog is only removed if expect is still the pending dialog for the user. It
+// returns true if a dialog was removed
+func (b *Bot) removePendingDialogIf(key dialogKey, expect *pendingDialog) bool {
+	b.dialogs.mu.Lock()
+	p, ok := b.dialogs.pending[key]
+	if ok && expect != nil && p != expect {
+		ok = false
+	}
+	if ok {
+		if p.timer != nil {
+			p.timer.Stop()
+		}
+		delete(b.dialogs.pending, key)
+	}
+	b.dialogs.mu.Unlock()
+
+	if ok && b.PersistDialogs {
+		if err := kvstore.Delete(b.KB, b.DialogTeam, b.DialogNamespace, kvstore.New(key.String(), nil, -1)); err != nil {
+			key.logger(b).With("dialog", p.Dialog).Error("Unable to remove persisted dialog: %v", err)
+		}
+	}
+	return ok
+}
+
+// expireDialog is called when a dialog's timeout is reached
+func (b *Bot) expireDialog(key dialogKey, p *pendingDialog) {
+	// the dialog may have been answered, cancelled, or replaced since the timer fired
+	if !b.removePendingDialogIf(key, p) {
+		return
+	}
+
+	key.logger(b).With("dialog", p.Dialog).Debug("Dialog timed out")
+	var channel chat1.ChatChannel
+	if p.Channel != nil {
+		channel = *p.Channel
+	}
+	message := fmt.Sprintf(b.lookup(b.localeFor(p.User, channel), MsgDialogTimeout), p.User)
+	b.sendAsync(p.ConvID, "message", "", func() (chat1.SendRes, error) {
+		return b.KB.SendMessageByConvID(p.ConvID, "%s", message)
+	})
+}
+
+// handleDialog passes a message to the sender's pending dialog in the conversation, if there
+// is one. It returns true if the message was handled by a dialog. Edits are never answers,
+// even when HandleEdits has made them look like text messages, since the edited message
+// could be from long before the question was asked
+func (b *Bot) handleDialog(m chat1.MsgSummary) bool {
+	if m.Content.TypeName != "text" || m.Content.Text == nil || IsEdit(m) {
+		return false
+	}
+
+	key := dialogKey{ConvID: m.ConvID, User: strings.ToLower(m.Sender.Username)}
+	b.dialogs.mu.Lock()
+	p, ok := b.dialogs.pending[key]
+	b.dialogs.mu.Unlock()
+	if !ok {
+		return false
+	}
+
+	logger := b.LoggerFor(m).With("dialog", p.Dialog)
+	d, ok := b.dialog(p.Dialog)
+	if !ok || p.Step >= len(d.Steps) {
+		logger.Warn("Pending dialog is no longer valid, discarding")
+		b.removePendingDialogIf(key, p)
+		return false
+	}
+
+	answer := strings.TrimSpace(m.Content.Text.Body)
+	if d.isCancel(answer) {
+		logger.Debug("Dialog cancelled")
+		b.removePendingDialog(key)
+		b.Reply(m, "%s", b.T(m, MsgDialogCancelled))
+		return true
+	}
+
+	step := d.Steps[p.Step]
+	if step.Validate != nil {
+		if err := step.Validate(answer); err != nil {
+			logger.Debug("Dialog answer was invalid: %v", err)
+			b.Reply(m, "%s\n%s", err.Error(), step.Prompt)
+			return true
+		}
+	}
+
+	next := p.next(step.Key, answer)
+	if next.Step < len(d.Steps) {
+		if !b.storePendingDialog(next, d, p) {
+			logger.Debug("Dialog ended before the answer was handled")
+			return true
+		}
+		b.Reply(m, "%s", d.Steps[next.Step].Prompt)
+		return true
+	}
+
+	if !b.removePendingDialogIf(key, p) {
+		logger.Debug("Dialog ended before the answer was handled")
+		return true
+	}
+	logger.Debug("Dialog complete")
+	if d.OnComplete != nil {
+		if err := d.OnComplete(m, next.Answers, b); err != nil {
+			reply, err := b.userMessage(m, err)
+			logger.With("error", err).Error("Dialog returned error: %v", err)
+			b.Reply(m, "%s", reply)
+		}
+	}
+	return true
+}
+
+// loadDialogs restores pending dialogs from the kvstore
+func (b *Bot) loadDialogs() {
+	if !b.PersistDialogs {
+		return
+	}
+
+	keys, err := kvstore.Keys(b.KB, b.DialogTeam, b.DialogNamespace)
+	if err != nil {
+		b.Logger.Error("Unable to list persisted dialogs: %v", err)
+		return
+	}
+	for _, key := range keys {
+		var p pendingDialog
+		if err := kvstore.Get(b.KB, b.DialogTeam, b.DialogNamespace, &kvstore.KV{Key: key, Value: &p}); err != nil {
+			if err != kvstore.ErrNotFound {
+				parseDialogKey(key).logger(b).Error("Unable to load persisted dialog: %v", err)
+			}
+			continue
+		}
+
+		d, ok := b.dialog(p.Dialog)
+		if !ok || p.Expires.Before(time.Now()) {
+			parseDialogKey(key).logger(b).With("dialog", p.Dialog).Debug("Discarding expired or unknown persisted dialog")
+			kvstore.Delete(b.KB, b.DialogTeam, b.DialogNamespace, kvstore.New(key, nil, -1))
+			continue
+		}
+		if p.Answers == nil {
+			p.Answers = make(map[string]string)
+		}
+		parseDialogKey(key).logger(b).With("dialog", p.Dialog).Debug("Restoring dialog")
+		b.setPendingDialog(&p, d)
+	}
+}
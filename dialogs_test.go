@@ -0,0 +1,66 @@
+package keybasebot
+
+import (
+	"testing"
+
+	"samhofi.us/x/keybase/v2/types/chat1"
+)
+
+func TestPendingDialogNext(t *testing.T) {
+	p := &pendingDialog{
+		Dialog:  "signup",
+		ConvID:  "conv",
+		User:    "alice",
+		Step:    0,
+		Answers: map[string]string{},
+	}
+	n := p.next("name", "Alice")
+	if p.Step != 0 || len(p.Answers) != 0 {
+		t.Errorf("next changed the original dialog: step %d, answers %v", p.Step, p.Answers)
+	}
+	if n.Step != 1 || n.Answers["name"] != "Alice" {
+		t.Errorf("next = step %d, answers %v, want step 1 with the answer", n.Step, n.Answers)
+	}
+	n2 := n.next("email", "a@example.com")
+	if len(n.Answers) != 1 || len(n2.Answers) != 2 {
+		t.Errorf("answers were shared between steps: %v, %v", n.Answers, n2.Answers)
+	}
+}
+
+func TestExpireDialogReplaced(t *testing.T) {
+	b := New("test")
+	key := dialogKey{ConvID: "conv", User: "alice"}
+	old := &pendingDialog{Dialog: "color", ConvID: "conv", User: "alice"}
+	current := &pendingDialog{Dialog: "color", ConvID: "conv", User: "alice"}
+	b.dialogs.pending[key] = current
+
+	b.expireDialog(key, old)
+	if b.dialogs.pending[key] != current {
+		t.Error("an old dialog's timeout removed the dialog that replaced it")
+	}
+}
+
+func TestHandleDialogIgnoresEdits(t *testing.T) {
+	b := New("test")
+	b.Dialogs = []Dialog{{Name: "color", Steps: []DialogStep{{Key: "color", Prompt: "Color?"}}}}
+	key := dialogKey{ConvID: "conv", User: "alice"}
+	p := &pendingDialog{Dialog: "color", ConvID: "conv", User: "alice", Answers: map[string]string{}}
+	b.dialogs.pending[key] = p
+
+	m := chat1.MsgSummary{
+		Id:     2,
+		ConvID: "conv",
+		Sender: chat1.MsgSender{Username: "alice"},
+		Content: chat1.MsgContent{
+			TypeName: "text",
+			Text:     &chat1.MessageText{Body: "blue"},
+			Edit:     &chat1.MessageEdit{MessageID: 1, Body: "blue"},
+		},
+	}
+	if b.handleDialog(m) {
+		t.Error("an edit was taken as a dialog answer")
+	}
+	if b.dialogs.pending[key] != p {
+		t.Error("an edit changed the pending dialog")
+	}
+}
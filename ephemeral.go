@@ -0,0 +1,151 @@
+package keybasebot
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"samhofi.us/x/keybase/v2"
+	"samhofi.us/x/keybase/v2/types/chat1"
+)
+
+// ephemeralError is an error that should be sent back to the chat as an exploding message
+type ephemeralError struct {
+	err      error
+	lifetime time.Duration
+}
+
+func (e ephemeralError) Error() string { return e.err.Error() }
+func (e ephemeralError) Unwrap() error { return e.err }
+
+// ExplodingErrors returns an Adapter that causes any error the command replies with to be
+// sent as an exploding message with the given lifetime. This also covers errors returned by
+// adapters that come after this one, so it's best to pass this first
+func ExplodingErrors(lifetime time.Duration) Adapter {
+	return func(botAction BotAction) BotAction {
+		return func(m chat1.MsgSummary, b *Bot) (bool, error) {
+			ok, err := botAction(m, b)
+			if ok && err != nil {
+				return ok, ephemeralError{err: err, lifetime: lifetime}
+			}
+			return ok, err
+		}
+	}
+}
+
+// errorLifetime returns the lifetime an error reply should have, or zero if it shouldn't
+// explode
+func errorLifetime(err error) time.Duration {
+	var e ephemeralError
+	if errors.As(err, &e) {
+		return e.lifetime
+	}
+	return 0
+}
+
+// currentCommand returns the command that is currently handling a message, if there is one
+func (b *Bot) currentCommand(m chat1.MsgSummary) *BotCommand {
+	if inv := b.invocation(m); inv != nil {
+		return inv.Command
+	}
+	return nil
+}
+
+// replyLifetime returns the lifetime replies to a message should have, based on the command
+// that is handling it
+func (b *Bot) replyLifetime(m chat1.MsgSummary) time.Duration {
+	if cmd := b.currentCommand(m); cmd != nil {
+		return cmd.Ephemeral
+	}
+	return 0
+}
+
+// ErrExplodingNotAllowed is returned when an exploding message can't be sent because the
+// conversation doesn't allow them, or because the message is an attachment, and
+// Bot.EphemeralFallback is not set
+var ErrExplodingNotAllowed = errors.New("exploding messages are not allowed in this conversation")
+
+// checkUpload returns ErrExplodingNotAllowed if the command handling a message sends
+// exploding replies, since attachments are always permanent. With Bot.EphemeralFallback
+// set, the upload is allowed and only a warning is logged
+func (b *Bot) checkUpload(m chat1.MsgSummary) error {
+	if b.replyLifetime(m) <= 0 {
+		return nil
+	}
+	if !b.EphemeralFallback {
+		b.LoggerFor(m).Debug("Attachments can't explode, not uploading a reply to message %d", m.Id)
+		return ErrExplodingNotAllowed
+	}
+	b.LoggerFor(m).Warn("Attachments can't explode, uploading a permanent reply to message %d", m.Id)
+	return nil
+}
+
+// isExplodingNotAllowed returns true if a send failed because the conversation doesn't allow
+// exploding messages. The keybase client doesn't return typed errors, so the message is all
+// we have
+func isExplodingNotAllowed(err error) bool {
+	msg := strings.ToLower(err.Error())
+	if !strings.Contains(msg, "exploding") && !strings.Contains(msg, "ephemeral") {
+		return false
+	}
+	return strings.Contains(msg, "not allowed") || strings.Contains(msg, "disabled") || strings.Contains(msg, "not supported")
+}
+
+// ReplyEphemeral sends a reply to a message as an exploding message with the given lifetime.
+// If exploding messages aren't allowed in the conversation, ErrExplodingNotAllowed is
+// returned and nothing is sent, unless Bot.EphemeralFallback is set, in which case a normal
+// reply is sent instead. Either way, the conversation is remembered so we don't try again.
+// Like Reply, a re-dispatched edit updates the existing reply instead of sending a new one
+func (b *Bot) ReplyEphemeral(m chat1.MsgSummary, lifetime time.Duration, message string, a ...interface{}) (chat1.SendRes, error) {
+	body := fmt.Sprintf(message, a...)
+	if lifetime <= 0 {
+		return b.sendReply(m, body)
+	}
+	if res, ok, err := b.editReply(m, body); ok {
+		return res, err
+	}
+
+	replyTo := m.Id
+	opts := keybase.SendMessageOptions{
+		ConversationID:    m.ConvID,
+		Message:           keybase.SendMessageBody{Body: body},
+		ReplyTo:           &replyTo,
+		ExplodingLifetime: &keybase.ExplodingLifetime{Duration: lifetime},
+	}
+	res, err := b.sendExploding(m, m.ConvID, "reply", opts, func() (chat1.SendRes, error) {
+		return b.sendReply(m, body)
+	})
+	if err != nil {
+		return res, err
+	}
+	if res.MessageID != nil {
+		b.replies.add(msgKey{ConvID: m.ConvID, MsgID: m.Id}, *res.MessageID)
+	}
+	return res, nil
+}
+
+// sendExploding sends an exploding message to conv, in response to m, through the Outbox. If
+// the conversation doesn't allow exploding messages, fallback is used to send a normal
+// message if Bot.EphemeralFallback is set, and ErrExplodingNotAllowed is returned otherwise.
+// Any other error is returned as it is, so a secret is never sent as a permanent message
+// just because the Keybase service was having a bad moment
+func (b *Bot) sendExploding(m chat1.MsgSummary, conv chat1.ConvIDStr, kind string, opts keybase.SendMessageOptions, fallback func() (chat1.SendRes, error)) (chat1.SendRes, error) {
+	if _, ok := b.noExplode.Load(conv); !ok {
+		res, err := b.send(conv, kind, b.TraceID(m), func() (chat1.SendRes, error) {
+			return b.KB.SendMessage("send", opts)
+		})
+		if err == nil || !isExplodingNotAllowed(err) {
+			return res, err
+		}
+		b.noExplode.Store(conv, struct{}{})
+	}
+
+	logger := b.LoggerFor(m).With("conv_id", conv)
+	if !b.EphemeralFallback {
+		logger.Debug("Exploding messages aren't allowed, not sending %s", kind)
+		return chat1.SendRes{}, ErrExplodingNotAllowed
+	}
+	logger.Warn("Exploding messages aren't allowed, sending normal %s instead", kind)
+	return fallback()
+}
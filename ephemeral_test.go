@@ -0,0 +1,96 @@
+package keybasebot
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"samhofi.us/x/keybase/v2/types/chat1"
+)
+
+func TestIsExplodingNotAllowed(t *testing.T) {
+	tests := []struct {
+		err  string
+		want bool
+	}{
+		{"exploding messages are not allowed in this conversation", true},
+		{"Ephemeral messages are disabled for this team", true},
+		{"connection reset by peer", false},
+		{"timeout sending exploding message", false},
+		{"not allowed", false},
+	}
+	for _, tt := range tests {
+		if got := isExplodingNotAllowed(errors.New(tt.err)); got != tt.want {
+			t.Errorf("isExplodingNotAllowed(%q) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+// ephemeralTestBot returns a Bot that is handling m with a command that sends exploding
+// replies, and whose Outbox doesn't wait between sends
+func ephemeralTestBot(m chat1.MsgSummary) *Bot {
+	b := New("test")
+	b.Outbox.GlobalInterval = 0
+	b.Outbox.ConvInterval = 0
+	b.invocations.Store(msgKey{ConvID: m.ConvID, MsgID: m.Id}, &invocation{
+		Command: &BotCommand{Name: "secret", Ephemeral: time.Minute},
+	})
+	return b
+}
+
+func TestReplyFileEphemeral(t *testing.T) {
+	m := chat1.MsgSummary{Id: 1, ConvID: "conv"}
+	tests := []struct {
+		name     string
+		fallback bool
+		want     error
+	}{
+		{"refused", false, ErrExplodingNotAllowed},
+		{"fallback", true, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := ephemeralTestBot(m)
+			b.EphemeralFallback = tt.fallback
+			b.TempDir = t.TempDir()
+			if err := b.ReplyFile(m, "body", "", ""); !errors.Is(err, tt.want) {
+				t.Errorf("ReplyFile returned %v, want %v", err, tt.want)
+			}
+			c := &Context{Bot: b, Message: m}
+			if _, err := c.Upload("file.txt", ""); !errors.Is(err, tt.want) {
+				t.Errorf("Upload returned %v, want %v", err, tt.want)
+			}
+			if err := b.ReplyLong(m, strings.Repeat("line\n", MaxMessageLength), LongReplyOptions{MaxChunks: 1}); !errors.Is(err, tt.want) {
+				t.Errorf("ReplyLong returned %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestReplyEphemeralEditsPreviousReply(t *testing.T) {
+	m := chat1.MsgSummary{
+		Id:     1,
+		ConvID: "conv",
+		Content: chat1.MsgContent{
+			TypeName: "text",
+			Text:     &chat1.MessageText{Body: "!secret"},
+			Edit:     &chat1.MessageEdit{MessageID: 1, Body: "!secret"},
+		},
+	}
+	b := ephemeralTestBot(m)
+	key := msgKey{ConvID: m.ConvID, MsgID: m.Id}
+	b.replies.add(key, 10)
+	b.replies.rewind(key)
+
+	if _, err := b.Reply(m, "hidden"); err != nil {
+		t.Fatalf("Reply returned error: %v", err)
+	}
+	if reply, ok := b.replies.next(key); ok {
+		t.Errorf("reply %d was not edited", reply)
+	}
+	tracked, _ := b.replies.remove(key)
+	if len(tracked.Replies) != 1 {
+		t.Errorf("replies = %v, want only the edited reply", tracked.Replies)
+	}
+}
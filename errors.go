@@ -0,0 +1,131 @@
+package keybasebot
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"samhofi.us/x/keybase/v2/types/chat1"
+)
+
+// UserError is an error that separates what is safe to show in chat from the internal cause
+// of the error. When a BotAction returns a UserError along with true, only Message is sent
+// back to the chat, while the full error, including the cause, is sent to the logger
+type UserError struct {
+	// The message that is safe to show to users
+	Message string
+
+	// The internal error that caused this one. This is only logged
+	Cause error
+
+	// An optional correlation ID, which is shown to the user and included in the logs, so
+	// a user's report can be matched with the logs
+	ID string
+}
+
+// NewUserError returns a new UserError with the given user-safe message and internal cause.
+// cause may be nil
+func NewUserError(message string, cause error) *UserError {
+	return &UserError{Message: message, Cause: cause}
+}
+
+// UserErrorf returns a new UserError with the given internal cause and a user-safe message
+// built from a format string
+func UserErrorf(cause error, format string, a ...interface{}) *UserError {
+	return NewUserError(fmt.Sprintf(format, a...), cause)
+}
+
+// Error returns the user-safe message followed by the internal cause, for logging
+func (e *UserError) Error() string {
+	msg := e.Message
+	if e.ID != "" {
+		msg = fmt.Sprintf("%s (ref: %s)", msg, e.ID)
+	}
+	if e.Cause != nil {
+		return fmt.Sprintf("%s: %v", msg, e.Cause)
+	}
+	return msg
+}
+
+// Unwrap returns the internal cause
+func (e *UserError) Unwrap() error {
+	return e.Cause
+}
+
+// SafeMessage returns the message that is safe to show to users, including the correlation
+// ID if there is one
+func (e *UserError) SafeMessage() string {
+	if e.ID != "" {
+		return fmt.Sprintf("%s (ref: %s)", e.Message, e.ID)
+	}
+	return e.Message
+}
+
+// WithID returns a copy of the error with a new random correlation ID. The error itself is
+// left alone, so this is safe to call on errors that are shared, like package-level
+// variables
+func (e *UserError) WithID() *UserError {
+	return e.withID(NewCorrelationID())
+}
+
+// withID returns a copy of the error with the given correlation ID
+func (e *UserError) withID(id string) *UserError {
+	c := *e
+	c.ID = id
+	return &c
+}
+
+// NewCorrelationID returns a short random ID that can be used to match a user's report with
+// the logs
+func NewCorrelationID() string {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return "00000000"
+	}
+	return hex.EncodeToString(b)
+}
+
+// LocalizedError returns a UserError with a message that has been translated for the sender
+// of m, and the given internal cause. See Bot.T
+func (b *Bot) LocalizedError(m chat1.MsgSummary, cause error, key string, a ...interface{}) *UserError {
+	return NewUserError(b.T(m, key, a...), cause)
+}
+
+// userMessage returns the part of an error that can be sent back to the chat, along with the
+// error that should be logged. UserErrors are reduced to their safe message. Other errors
+// are replaced with a generic message, unless Bot.HideInternalErrors has been turned off, in
+// which case they are sent as they are. If Bot.ErrorIDs is set, a correlation ID is added to
+// the error, using the message's trace ID if there is one
+func (b *Bot) userMessage(m chat1.MsgSummary, err error) (string, error) {
+	var ue *UserError
+	if errors.As(err, &ue) {
+		if b.ErrorIDs && ue.ID == "" {
+			ue = ue.withID(b.errorID(m))
+			return ue.SafeMessage(), fmt.Errorf("%w (ref: %s)", err, ue.ID)
+		}
+		return ue.SafeMessage(), err
+	}
+
+	if !b.HideInternalErrors && !b.ErrorIDs {
+		return err.Error(), err
+	}
+
+	ue = NewUserError(err.Error(), err)
+	if b.HideInternalErrors {
+		ue = b.LocalizedError(m, err, MsgInternalError)
+	}
+	if b.ErrorIDs {
+		ue.ID = b.errorID(m)
+	}
+	return ue.SafeMessage(), ue
+}
+
+// errorID returns the correlation ID for an error reply, which is the message's trace ID,
+// or a new random ID if there isn't a trace
+func (b *Bot) errorID(m chat1.MsgSummary) string {
+	if trace := b.TraceID(m); trace != "" {
+		return trace
+	}
+	return NewCorrelationID()
+}
@@ -0,0 +1,64 @@
+package keybasebot
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"samhofi.us/x/keybase/v2/types/chat1"
+)
+
+var errShared = NewUserError("shared message", nil)
+
+func TestUserMessage(t *testing.T) {
+	internal := errors.New("unable to fetch key from store: boom")
+	tests := []struct {
+		name       string
+		hide       bool
+		ids        bool
+		trace      string
+		err        error
+		wantReply  string
+		wantLogged string
+	}{
+		{"internal hidden", true, false, "", internal, englishCatalog[MsgInternalError], "boom"},
+		{"internal shown", false, false, "", internal, internal.Error(), "boom"},
+		{"user error", true, false, "", NewUserError("bad input", internal), "bad input", "boom"},
+		{"wrapped user error", true, false, "", fmt.Errorf("ctx: %w", NewUserError("bad input", nil)), "bad input", "bad input"},
+		{"user error with trace id", true, true, "abc123", NewUserError("bad input", nil), "bad input (ref: abc123)", "abc123"},
+		{"internal with trace id", true, true, "abc123", internal, englishCatalog[MsgInternalError] + " (ref: abc123)", "boom"},
+		{"shared error", true, true, "abc123", errShared, "shared message (ref: abc123)", "abc123"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &Bot{HideInternalErrors: tt.hide, ErrorIDs: tt.ids, invocations: &sync.Map{}}
+			m := chat1.MsgSummary{ConvID: "conv", Id: 1}
+			if tt.trace != "" {
+				b.invocations.Store(msgKey{ConvID: m.ConvID, MsgID: m.Id}, &invocation{TraceID: tt.trace})
+			}
+			reply, logged := b.userMessage(m, tt.err)
+			if reply != tt.wantReply {
+				t.Errorf("reply = %q, want %q", reply, tt.wantReply)
+			}
+			if !strings.Contains(logged.Error(), tt.wantLogged) {
+				t.Errorf("logged error %q does not contain %q", logged, tt.wantLogged)
+			}
+		})
+	}
+	if errShared.ID != "" {
+		t.Errorf("userMessage changed a shared error's ID to %q", errShared.ID)
+	}
+}
+
+func TestUserErrorWithID(t *testing.T) {
+	e := NewUserError("msg", nil)
+	c := e.WithID()
+	if e.ID != "" {
+		t.Errorf("WithID changed the original error")
+	}
+	if c.ID == "" || c.Message != "msg" {
+		t.Errorf("WithID returned %+v", c)
+	}
+}
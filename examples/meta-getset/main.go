@@ -5,12 +5,10 @@ package main
 
 import (
 	"flag"
-	"fmt"
 	"os"
 	"strings"
 
 	bot "github.com/kf5grd/keybasebot"
-	"github.com/kf5grd/keybasebot/pkg/util"
 	"samhofi.us/x/keybase/v2"
 	"samhofi.us/x/keybase/v2/types/chat1"
 )
@@ -73,8 +71,8 @@ var setMessageAd = chat1.UserBotCommandInput{
 func setMessage(m chat1.MsgSummary, b *bot.Bot) (bool, error) {
 	message := strings.TrimSpace(strings.Replace(m.Content.Text.Body, "!set", "", 1))
 	if message == "" {
-		err := fmt.Errorf("Must provide a message.")
-		b.Logger.Error("Error setting message value from '%s' in '%s': %v", m.Sender.Username, util.ChannelString(m.Channel), err)
+		err := bot.NewUserError("Must provide a message.", nil)
+		b.LoggerFor(m).Error("Error setting message value: %v", err)
 		return true, err
 	}
 
@@ -102,15 +100,20 @@ func getMessage(m chat1.MsgSummary, b *bot.Bot) (bool, error) {
 	if !ok {
 		// setting this to true and returning an error means the bot won't
 		// look for any more commands to execute after this one runs, and
-		// it will reply to the user with the error message. if we set the
+		// it will reply to the user with the error message. only UserErrors
+		// are shown as they are, other errors are replaced with a generic
+		// message unless b.HideInternalErrors is turned off. if we set the
 		// boolean to false and return an error, the erro message gets sent
 		// to the logs, but does not get sent to the user, and the bot
 		// continues to loop through each of the commands trying to run them
-		return true, fmt.Errorf("No message has been set yet. Send `!set <message>` to set one.")
+		return true, bot.NewUserError("No message has been set yet. Send `!set <message>` to set one.", nil)
 	}
 
 	// if we get this far it means there was a message set,
 	// and we reply to the user with the message
-	b.KB.ReplyByConvID(m.ConvID, m.Id, message.(string))
-	return false, nil
+	b.Reply(m, "%s", message.(string))
+
+	// we've handled the command, so the bot doesn't need to
+	// look for any more commands to execute
+	return true, nil
 }
@@ -2,7 +2,9 @@ package keybasebot
 
 import (
 	"strings"
+	"time"
 
+	"github.com/kf5grd/keybasebot/pkg/logr"
 	"github.com/kf5grd/keybasebot/pkg/util"
 	"samhofi.us/x/keybase/v2/types/chat1"
 )
@@ -12,6 +14,11 @@ func (b *Bot) registerHandlers() {
 	b.Handlers.ChatHandler = &chat
 }
 
+// identityFields are the log fields that identify a user, conversation, or team, which are
+// hashed when Bot.HashLogIdentities is set. Log these as fields instead of formatting them
+// into the message, so they can be hashed
+var identityFields = []string{"conv_id", "sender", "channel", "user", "users", "team"}
+
 func (b *Bot) chatHandler(m chat1.MsgSummary) {
 	var (
 		sender  = m.Sender.Username
@@ -23,6 +30,62 @@ func (b *Bot) chatHandler(m chat1.MsgSummary) {
 		return
 	}
 
+	// Never run commands from the log conversation. The bot's own log messages are posted
+	// there, so with AllowSelfMessages set they could trigger more logging forever
+	if b.LogConv != "" && m.ConvID == b.LogConv {
+		return
+	}
+
+	// Every log line caused by this message, including the logs of the messages the bot
+	// sends, is tagged with the same trace ID. The fields that identify
+	// the sender and conversation are attached before anything is logged, so they can be
+	// hashed. Keep identityFields up to date with any fields added here that identify a user
+	// or conversation
+	traceID := NewCorrelationID()
+	logger := b.Logger.WithFields(logr.Fields{
+		"trace_id": traceID,
+		"conv_id":  m.ConvID,
+		"msg_id":   m.Id,
+		"sender":   sender,
+		"channel":  channel,
+	})
+
+	// Cached copies of edited or deleted messages are out of date
+	b.forgetMessages(m)
+
+	// If HandleEdits is set, rewrite edits so they look like the original text message with
+	// the updated body, and prepare to edit any replies we already sent to the original
+	if b.HandleEdits && m.Content.TypeName == "edit" && m.Content.Edit != nil {
+		logger.Debug("Re-dispatching edit of message %d as a text message", m.Content.Edit.MessageID)
+		var replyTo *chat1.MessageID
+		original, err := b.fetchMessage(logger, m.ConvID, m.Content.Edit.MessageID)
+		if err != nil {
+			logger.Warn("Unable to fetch edited message %d, it will not be treated as a reply: %v", m.Content.Edit.MessageID, err)
+		} else if original.Content.Text != nil {
+			replyTo = original.Content.Text.ReplyTo
+		}
+		m = editAsText(m, replyTo)
+		logger = logger.With("msg_id", m.Id)
+		b.replies.rewind(msgKey{ConvID: m.ConvID, MsgID: m.Id})
+	}
+
+	// Keep track of the message while it's being handled, so the trace ID and logger can be
+	// found from anywhere that has the message
+	key := msgKey{ConvID: m.ConvID, MsgID: m.Id}
+	b.invocations.Store(key, &invocation{TraceID: traceID, Logger: logger})
+	defer b.invocations.Delete(key)
+
+	// If a message was deleted, retract any replies that were sent in response to it
+	if m.Content.TypeName == "delete" {
+		b.retractReplies(m)
+	}
+
+	// If the sender has a dialog waiting for an answer in this conversation, the message
+	// belongs to the dialog and shouldn't be passed to any commands
+	if b.handleDialog(m) {
+		return
+	}
+
 	// If CommandPrefix is set and message is a text message, make sure it has the
 	// correct prefix
 	if b.CommandPrefix != "" && m.Content.TypeName == "text" {
@@ -33,20 +96,53 @@ func (b *Bot) chatHandler(m chat1.MsgSummary) {
 
 	// Cycle through each action and run them until we reach the end, or until a command
 	// requests to stop execution of subsequent commands
-	b.Logger.Debug("Incoming message from %s", sender)
-	for _, action := range b.Commands {
+	logger.Debug("Incoming message")
+	for i := range b.Commands {
+		action := &b.Commands[i]
 		actionName := action.Name
-		b.Logger.Debug("Trying %s", actionName)
-		ok, err := action.Run(m, b)
+		inv := &invocation{
+			TraceID: traceID,
+			Logger:  logger.WithComponent(actionName).With("command", actionName),
+			Command: action,
+		}
+		inv.Logger.Debug("Trying %s", actionName)
+		b.invocations.Store(key, inv)
+		start := time.Now()
+		res := action.action()(m, b)
+		cmdLogger := inv.Logger.WithFields(logr.Fields{
+			"duration": time.Since(start),
+			"outcome":  res.Outcome,
+		})
+
+		err := res.Err
 		if err != nil {
-			b.Logger.Error("[%v][%s in %s] %s returned error: %v", m.ConvID, sender, channel, actionName, err)
-			if ok {
-				b.KB.ReplyByConvID(m.ConvID, m.Id, err.Error())
+			var reply string
+			if res.Outcome == OutcomeHandledWithUserError {
+				// Only the user-safe part of the error is sent back to the chat, but the full
+				// error is logged
+				reply, err = b.userMessage(m, err)
+			}
+			cmdLogger.With("error", err).Error("%s returned error: %v", actionName, err)
+			if res.Outcome == OutcomeHandledWithUserError {
+				var replyErr error
+				if lifetime := errorLifetime(err); lifetime > 0 {
+					_, replyErr = b.ReplyEphemeral(m, lifetime, "%s", reply)
+				} else {
+					_, replyErr = b.Reply(m, "%s", reply)
+				}
+				if replyErr != nil {
+					cmdLogger.Warn("Unable to reply with error: %v", replyErr)
+				}
 			}
 		}
-		if ok {
-			b.Logger.Debug("%s ok = true, cancelling execution of subsequent commands", actionName)
+		b.replies.claim(key, action.RetractOnDelete)
+
+		switch res.Outcome {
+		case OutcomeHandled, OutcomeHandledWithUserError:
+			cmdLogger.Debug("%s outcome = %s, cancelling execution of subsequent commands", actionName, res.Outcome)
 			return
+		case OutcomeContinue:
+			cmdLogger.Debug("%s outcome = %s, trying subsequent commands", actionName, res.Outcome)
 		}
 	}
 }
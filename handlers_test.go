@@ -0,0 +1,68 @@
+package keybasebot
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/kf5grd/keybasebot/pkg/logr"
+	"samhofi.us/x/keybase/v2/types/chat1"
+)
+
+func TestChatHandlerIdentityFields(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		dialog bool
+	}{
+		{"command", "!hello", false},
+		{"dialog answer", "blue", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				b    = New("test")
+				logs = logr.NewRingBuffer(100, logr.LevelTrace)
+				m    = chat1.MsgSummary{
+					Id:     1,
+					ConvID: "conv",
+					Sender: chat1.MsgSender{Username: "alice"},
+					Content: chat1.MsgContent{
+						TypeName: "text",
+						Text:     &chat1.MessageText{Body: tt.body},
+					},
+				}
+			)
+			b.Logger = logr.New(ioutil.Discard, true, false)
+			b.Logger.MinLevel = logr.LevelTrace
+			b.Logger.Handler = logs
+			b.Dialogs = []Dialog{{Name: "color", Steps: []DialogStep{{Key: "color", Prompt: "Color?"}}}}
+			if tt.dialog {
+				b.dialogs.pending[dialogKey{ConvID: m.ConvID, User: "alice"}] = &pendingDialog{
+					Dialog:  "color",
+					ConvID:  m.ConvID,
+					User:    "alice",
+					Answers: map[string]string{},
+				}
+			}
+			b.Commands = []BotCommand{{
+				Name: "hello",
+				Run: func(chat1.MsgSummary, *Bot) (bool, error) {
+					return true, nil
+				},
+			}}
+
+			b.chatHandler(m)
+			msgs := logs.Messages()
+			if len(msgs) == 0 {
+				t.Fatal("nothing was logged")
+			}
+			for _, msg := range msgs {
+				for _, field := range []string{"trace_id", "conv_id", "sender"} {
+					if _, ok := msg.Fields[field]; !ok {
+						t.Errorf("%q was logged without the %s field", msg.Message, field)
+					}
+				}
+			}
+		})
+	}
+}
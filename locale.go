@@ -0,0 +1,263 @@
+package keybasebot
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/kf5grd/keybasebot/pkg/kvstore"
+	"github.com/kf5grd/keybasebot/pkg/util"
+	"samhofi.us/x/keybase/v2"
+	"samhofi.us/x/keybase/v2/types/chat1"
+)
+
+// DefaultLocale is the locale used when neither the user nor the team has chosen one, and
+// Bot.DefaultLocale is not changed
+const DefaultLocale = "en"
+
+// DefaultLocaleNamespace is the kvstore namespace used for locale settings when
+// Bot.LocaleNamespace is not changed
+const DefaultLocaleNamespace = "keybasebot-locales"
+
+// Catalog maps message keys to fmt format strings for a single locale
+type Catalog map[string]string
+
+// These constants are the keys of the messages the framework sends to users. You can
+// translate them by adding them to a Catalog in Bot.Catalogs
+const (
+	MsgMinRole                 = "keybasebot.min_role"
+	MsgMinTeamRole             = "keybasebot.min_team_role"
+	MsgPermissionDenied        = "keybasebot.permission_denied"
+	MsgPermissionLookupFailed  = "keybasebot.permission_lookup_failed"
+	MsgPermissionUsage         = "keybasebot.permission_usage"
+	MsgPermissionGrantFailed   = "keybasebot.permission_grant_failed"
+	MsgPermissionRevokeFailed  = "keybasebot.permission_revoke_failed"
+	MsgPermissionListFailed    = "keybasebot.permission_list_failed"
+	MsgPermissionNone          = "keybasebot.permission_none"
+	MsgParentFetchFailed       = "keybasebot.parent_fetch_failed"
+	MsgAttachmentFailed        = "keybasebot.attachment_failed"
+	MsgDialogCancelled         = "keybasebot.dialog_cancelled"
+	MsgDialogTimeout           = "keybasebot.dialog_timeout"
+	MsgLocaleUsage             = "keybasebot.locale_usage"
+	MsgLocaleSet               = "keybasebot.locale_set"
+	MsgLocaleCleared           = "keybasebot.locale_cleared"
+	MsgLocaleInvalid           = "keybasebot.locale_invalid"
+	MsgLocaleFailed            = "keybasebot.locale_failed"
+	MsgLocaleTeamRoleRequired  = "keybasebot.locale_team_role_required"
+	MsgLocaleTeamConvsRequired = "keybasebot.locale_team_convs_required"
+	MsgInternalError           = "keybasebot.internal_error"
+	MsgProgressWorking         = "keybasebot.progress_working"
+	MsgProgressCancelled       = "keybasebot.progress_cancelled"
+)
+
+// englishCatalog holds the framework's built-in messages, and is the final fallback for
+// every lookup
+var englishCatalog = Catalog{
+	MsgMinRole:                 "Your role must be at least %s to do that.",
+	MsgMinTeamRole:             "Your role in %s must be at least %s to do that.",
+	MsgPermissionDenied:        "You need the %s permission to do that.",
+	MsgPermissionLookupFailed:  "Unable to verify your permissions right now.",
+	MsgPermissionUsage:         "Usage: `%s <permission> <user> [user...]`",
+	MsgPermissionGrantFailed:   "Unable to grant permission %s.",
+	MsgPermissionRevokeFailed:  "Unable to revoke permission %s.",
+	MsgPermissionListFailed:    "Unable to list permissions.",
+	MsgPermissionNone:          "No permissions have been granted yet.",
+	MsgParentFetchFailed:       "Unable to fetch the message you replied to.",
+	MsgAttachmentFailed:        "Unable to download your attachment.",
+	MsgDialogCancelled:         "Cancelled.",
+	MsgDialogTimeout:           "@%s, I stopped waiting for your answer.",
+	MsgLocaleUsage:             "Usage: `%s [team] <locale>`",
+	MsgLocaleSet:               "Language set to %s.",
+	MsgLocaleCleared:           "Language reset to the default.",
+	MsgLocaleInvalid:           "%s is not a language I know.",
+	MsgLocaleFailed:            "Unable to change your language right now.",
+	MsgLocaleTeamRoleRequired:  "Your role must be at least %s to change the team's language.",
+	MsgLocaleTeamConvsRequired: "The team language can only be set from a team conversation.",
+	MsgInternalError:           "Something went wrong while handling your message.",
+	MsgProgressWorking:         "Working…",
+	MsgProgressCancelled:       "Cancelled because the bot is shutting down.",
+}
+
+// userLocaleKey and teamLocaleKey return the kvstore keys for locale settings
+func userLocaleKey(user string) string { return "user/" + strings.ToLower(user) }
+func teamLocaleKey(team string) string { return "team/" + strings.ToLower(team) }
+
+// storedLocale returns the locale stored under a kvstore key, or an empty string if none is
+// set. Results are cached, including misses
+func (b *Bot) storedLocale(key string) string {
+	if locale, ok := b.locales.Load(key); ok {
+		return locale.(string)
+	}
+
+	var locale string
+	err := kvstore.Get(b.KB, b.LocaleTeam, b.LocaleNamespace, &kvstore.KV{Key: key, Value: &locale})
+	if err != nil && err != kvstore.ErrNotFound {
+		// Don't cache errors so we try again next time. The key is "user/<name>" or
+		// "team/<name>", and the name goes in a field so HashLogIdentities covers it
+		parts := strings.SplitN(key, "/", 2)
+		b.Logger.With(parts[0], parts[len(parts)-1]).Error("Unable to look up %s locale: %v", parts[0], err)
+		return ""
+	}
+	b.locales.Store(key, locale)
+	return locale
+}
+
+// localeFor returns the locale for a user in a channel. The user's own setting is used
+// first, then the team's setting, then Bot.DefaultLocale
+func (b *Bot) localeFor(user string, channel chat1.ChatChannel) string {
+	if user != "" {
+		if locale := b.storedLocale(userLocaleKey(user)); locale != "" {
+			return locale
+		}
+	}
+	if channel.MembersType == keybase.TEAM {
+		if locale := b.storedLocale(teamLocaleKey(channel.Name)); locale != "" {
+			return locale
+		}
+	}
+	if b.DefaultLocale != "" {
+		return b.DefaultLocale
+	}
+	return DefaultLocale
+}
+
+// Locale returns the locale that should be used when replying to a message
+func (b *Bot) Locale(m chat1.MsgSummary) string {
+	return b.localeFor(m.Sender.Username, m.Channel)
+}
+
+// SetUserLocale stores the locale a user prefers. Pass an empty locale to clear it
+func (b *Bot) SetUserLocale(user, locale string) error {
+	return b.setLocale(userLocaleKey(user), locale)
+}
+
+// SetTeamLocale stores the locale for a team. Pass an empty locale to clear it
+func (b *Bot) SetTeamLocale(team, locale string) error {
+	return b.setLocale(teamLocaleKey(team), locale)
+}
+
+func (b *Bot) setLocale(key, locale string) error {
+	var err error
+	if locale == "" {
+		err = kvstore.Delete(b.KB, b.LocaleTeam, b.LocaleNamespace, kvstore.New(key, nil, -1))
+	} else {
+		err = kvstore.Put(b.KB, b.LocaleTeam, b.LocaleNamespace, kvstore.New(key, locale, -1))
+	}
+	if err != nil {
+		return err
+	}
+	b.locales.Store(key, locale)
+	return nil
+}
+
+// localeTag matches locale tags like "en", "pt-BR", and "zh_Hant_TW"
+var localeTag = regexp.MustCompile(`^[A-Za-z]{2,3}([-_][A-Za-z0-9]{2,8})*$`)
+
+// KnownLocale returns true if locale is a well-formed locale tag with a catalog, either for
+// the locale itself or for its base language. The built-in English messages count as a
+// catalog for DefaultLocale
+func (b *Bot) KnownLocale(locale string) bool {
+	if !localeTag.MatchString(locale) {
+		return false
+	}
+	candidates := []string{locale}
+	if i := strings.IndexAny(locale, "-_"); i > 0 {
+		candidates = append(candidates, locale[:i])
+	}
+	for _, c := range candidates {
+		if _, ok := b.Catalogs[c]; ok || c == DefaultLocale {
+			return true
+		}
+	}
+	return false
+}
+
+// lookup returns the format string for a message key in a locale. If the locale doesn't
+// have the key, the base language (e.g. "pt" for "pt-BR") is tried, then Bot.DefaultLocale,
+// then the built-in English messages. If nothing is found, the key itself is returned
+func (b *Bot) lookup(locale, key string) string {
+	candidates := []string{locale}
+	if i := strings.IndexAny(locale, "-_"); i > 0 {
+		candidates = append(candidates, locale[:i])
+	}
+	candidates = append(candidates, b.DefaultLocale, DefaultLocale)
+
+	for _, c := range candidates {
+		if catalog, ok := b.Catalogs[c]; ok {
+			if format, ok := catalog[key]; ok {
+				return format
+			}
+		}
+	}
+	if format, ok := englishCatalog[key]; ok {
+		return format
+	}
+	return key
+}
+
+// T returns the message for key, translated into the locale for the sender of m, and
+// formatted with the given arguments
+func (b *Bot) T(m chat1.MsgSummary, key string, a ...interface{}) string {
+	return fmt.Sprintf(b.lookup(b.Locale(m), key), a...)
+}
+
+// Errorf is like T, but returns the message as a UserError, which is handy for returning
+// translated errors from a BotAction
+func (b *Bot) Errorf(m chat1.MsgSummary, key string, a ...interface{}) error {
+	return b.LocalizedError(m, nil, key, a...)
+}
+
+// LocaleCommand returns a BotCommand that lets users choose their language with
+// "<prefix>locale <locale>". Users with at least the given role in a team can set the
+// team's language with "<prefix>locale team <locale>". Use "none" as the locale to clear
+// the setting
+func LocaleCommand(prefix, teamRole string) BotCommand {
+	command := prefix + "locale"
+	return BotCommand{
+		Name: "SetLocale",
+		Ad: &chat1.UserBotCommandInput{
+			Name:        "locale",
+			Usage:       "[team] <locale>",
+			Description: "Choose the language the bot replies in",
+		},
+		Run: Adapt(func(m chat1.MsgSummary, b *Bot) (bool, error) {
+			args := strings.Fields(strings.TrimPrefix(m.Content.Text.Body, command))
+			if len(args) == 0 || len(args) > 2 || (len(args) == 2 && args[0] != "team") {
+				return true, b.Errorf(m, MsgLocaleUsage, command)
+			}
+
+			locale := args[len(args)-1]
+			if strings.EqualFold(locale, "none") {
+				locale = ""
+			} else if !b.KnownLocale(locale) {
+				return true, b.Errorf(m, MsgLocaleInvalid, locale)
+			}
+
+			var err error
+			if len(args) == 2 {
+				if m.Channel.MembersType != keybase.TEAM {
+					return true, b.Errorf(m, MsgLocaleTeamConvsRequired)
+				}
+				if !util.HasMinTeamRole(b.KB, teamRole, m.Sender.Username, m.Channel.Name) {
+					return true, b.Errorf(m, MsgLocaleTeamRoleRequired, teamRole)
+				}
+				err = b.SetTeamLocale(m.Channel.Name, locale)
+			} else {
+				err = b.SetUserLocale(m.Sender.Username, locale)
+			}
+			if err != nil {
+				return true, b.LocalizedError(m, err, MsgLocaleFailed)
+			}
+
+			if locale == "" {
+				b.Reply(m, "%s", b.T(m, MsgLocaleCleared))
+				return true, nil
+			}
+			b.Reply(m, "%s", b.T(m, MsgLocaleSet, locale))
+			return true, nil
+		},
+			MessageType("text"),
+			CommandPrefix(command),
+		),
+	}
+}
@@ -0,0 +1,32 @@
+package keybasebot
+
+import "testing"
+
+func TestKnownLocale(t *testing.T) {
+	b := &Bot{Catalogs: map[string]Catalog{
+		"de":    {},
+		"pt-BR": {},
+	}}
+	tests := []struct {
+		locale string
+		want   bool
+	}{
+		{"en", true},
+		{"en-US", true},
+		{"de", true},
+		{"de-AT", true},
+		{"de_AT", true},
+		{"pt-BR", true},
+		{"pt", false},
+		{"fr", false},
+		{"", false},
+		{"e", false},
+		{"en US", false},
+		{"../en", false},
+	}
+	for _, tt := range tests {
+		if got := b.KnownLocale(tt.locale); got != tt.want {
+			t.Errorf("KnownLocale(%q) = %v, want %v", tt.locale, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package keybasebot
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/kf5grd/keybasebot/pkg/logr"
+	"github.com/kf5grd/keybasebot/pkg/render"
+	"samhofi.us/x/keybase/v2"
+	"samhofi.us/x/keybase/v2/types/chat1"
+)
+
+// Defaults for sending log messages to Bot.LogConv
+const (
+	DefaultLogConvInterval     = 5 * time.Second
+	DefaultLogConvMaxPerMinute = 10
+)
+
+const (
+	// logConvBatchSize is the most text that goes into a single log message, leaving room
+	// for the code fences and the dropped message notice
+	logConvBatchSize = MaxMessageLength - 200
+
+	// logConvMaxBuffered is how much text can wait for the next send before new log lines
+	// are dropped
+	logConvMaxBuffered = 4 * logConvBatchSize
+
+	// logConvKind is the kind of Outbox send used for log messages. The Outbox doesn't log
+	// failures of these sends, since the log lines would be queued for the same conversation
+	logConvKind = "log"
+)
+
+// logHandler builds the handler that receives the bot's log messages, from LogWriter,
+// LogConv, and LogHandlers
+func (b *Bot) logHandler() logr.Handler {
+	handlers := make(logr.MultiHandler, 0, len(b.LogHandlers)+2)
+	if b.LogWriter != nil {
+		handlers = append(handlers, logr.NewWriterHandler(b.LogWriter, b.JSON, logr.LevelUnknown))
+	}
+
+	// if LogConv is empty (which is the default) then logs will only be written to the
+	// LogWriter, but if a conversation id is set then logs will be written to the LogWriter
+	// *and* this conversation
+	b.logConv = nil
+	if b.LogConv != "" {
+		b.logConv = newConvHandler(b)
+		handlers = append(handlers, b.logConv)
+	}
+	return append(handlers, b.LogHandlers...)
+}
+
+// convHandler is a logr.Handler that sends log messages to a Keybase chat conversation. Log
+// lines are buffered and sent together in a code block every Interval, and no more than
+// MaxPerMinute messages are sent each minute
+type convHandler struct {
+	ConvID       chat1.ConvIDStr
+	KB           *keybase.Keybase
+	Outbox       *Outbox
+	JSON         bool
+	MinLevel     logr.Level
+	Interval     time.Duration
+	MaxPerMinute int
+
+	// Errors from sending to the conversation are written here, since logging them would
+	// just add more lines to a conversation we can't send to
+	ErrWriter io.Writer
+
+	mu      sync.Mutex
+	lines   []string
+	size    int
+	dropped int
+	sent    []time.Time
+	flush   chan struct{}
+	done    chan struct{}
+}
+
+// newConvHandler returns a convHandler using the bot's LogConv settings
+func newConvHandler(b *Bot) *convHandler {
+	ch := &convHandler{
+		ConvID:       b.LogConv,
+		KB:           b.KB,
+		Outbox:       b.Outbox,
+		JSON:         b.JSON,
+		MinLevel:     b.LogConvLevel,
+		Interval:     b.LogConvInterval,
+		MaxPerMinute: b.LogConvMaxPerMinute,
+		ErrWriter:    b.LogWriter,
+		flush:        make(chan struct{}, 1),
+		done:         make(chan struct{}),
+	}
+	if ch.MinLevel == logr.LevelUnknown {
+		ch.MinLevel = logr.LevelInfo
+	}
+	if ch.Interval <= 0 {
+		ch.Interval = DefaultLogConvInterval
+	}
+	return ch
+}
+
+// Enabled returns true if level is at least the convHandler's MinLevel
+func (ch *convHandler) Enabled(level logr.Level) bool {
+	return level.AtLeast(ch.MinLevel)
+}
+
+// Handle adds a log message to the buffer. If the buffer is full the message is dropped
+func (ch *convHandler) Handle(m logr.Msg) error {
+	line := logr.FormatText(m)
+	if ch.JSON {
+		line = logr.FormatJSON(m)
+	}
+	if len(line) > logConvBatchSize {
+		cut := logConvBatchSize - 4
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		line = line[:cut] + "...\n"
+	}
+
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	if ch.size+len(line) > logConvMaxBuffered {
+		ch.dropped++
+		return nil
+	}
+	ch.lines = append(ch.lines, line)
+	ch.size += len(line)
+
+	// don't wait for the next tick if there's already enough for a full message
+	if ch.size >= logConvBatchSize {
+		select {
+		case ch.flush <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// run sends the buffered log messages every Interval until ctx is cancelled, and then sends
+// whatever is left
+func (ch *convHandler) run(ctx context.Context) {
+	defer close(ch.done)
+	ticker := time.NewTicker(ch.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			ch.send()
+		case <-ch.flush:
+			ch.send()
+		case <-ctx.Done():
+			ch.send()
+			return
+		}
+	}
+}
+
+// allow returns true if another message can be sent without going over MaxPerMinute. It
+// must be called with the lock held
+func (ch *convHandler) allow(now time.Time) bool {
+	if ch.MaxPerMinute <= 0 {
+		return true
+	}
+	cutoff := now.Add(-time.Minute)
+	i := 0
+	for i < len(ch.sent) && ch.sent[i].Before(cutoff) {
+		i++
+	}
+	ch.sent = ch.sent[i:]
+	return len(ch.sent) < ch.MaxPerMinute
+}
+
+// next removes the next batch of log lines from the buffer, and returns the body of the
+// message to send. The body is empty if there's nothing to send, or if the rate limit has
+// been reached, in which case the batch is dropped
+func (ch *convHandler) next() string {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	if len(ch.lines) == 0 && ch.dropped == 0 {
+		return ""
+	}
+
+	var (
+		n    int
+		size int
+	)
+	for n < len(ch.lines) && size+len(ch.lines[n]) <= logConvBatchSize {
+		size += len(ch.lines[n])
+		n++
+	}
+	batch := ch.lines[:n]
+	ch.lines = ch.lines[n:]
+	ch.size -= size
+
+	now := time.Now()
+	if !ch.allow(now) {
+		ch.dropped += len(batch)
+		return ""
+	}
+	ch.sent = append(ch.sent, now)
+
+	var body string
+	if len(batch) > 0 {
+		body = string(render.CodeBlock(strings.Join(batch, "")))
+	}
+	if ch.dropped > 0 {
+		body = strings.TrimSpace(fmt.Sprintf("%s\n_%d log messages dropped_", body, ch.dropped))
+		ch.dropped = 0
+	}
+	return body
+}
+
+// send sends the buffered log messages to the conversation through the Outbox, as many
+// messages as needed, or until the rate limit is reached
+func (ch *convHandler) send() {
+	for {
+		body := ch.next()
+		if body == "" {
+			return
+		}
+		opts := keybase.SendMessageOptions{
+			ConversationID: ch.ConvID,
+			NonBlock:       true,
+			Message:        keybase.SendMessageBody{Body: body},
+		}
+		_, err := ch.Outbox.Send(ch.ConvID, logConvKind, func() (chat1.SendRes, error) {
+			return ch.KB.SendMessage("send", opts)
+		})
+		if err != nil && ch.ErrWriter != nil {
+			fmt.Fprintf(ch.ErrWriter, "unable to send logs to conversation %s: %v\n", ch.ConvID, err)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package keybasebot
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/kf5grd/keybasebot/pkg/logr"
+	"samhofi.us/x/keybase/v2"
+)
+
+// countingMetrics counts the sends of each kind
+type countingMetrics struct {
+	mu    sync.Mutex
+	sends map[string]int
+}
+
+func (c *countingMetrics) Count(name string, _ int64, tags map[string]string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if name == "outbox.sent" {
+		c.sends[tags["kind"]]++
+	}
+}
+
+func (c *countingMetrics) Timing(string, time.Duration, map[string]string) {}
+
+func TestConvHandlerTruncate(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  string
+	}{
+		{"ascii", strings.Repeat("a", 2*logConvBatchSize)},
+		{"two byte runes", strings.Repeat("é", logConvBatchSize)},
+		{"three byte runes", strings.Repeat("€", logConvBatchSize)},
+		{"four byte runes", strings.Repeat("🙂", logConvBatchSize)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ch := &convHandler{flush: make(chan struct{}, 1)}
+			ch.Handle(logr.Msg{Level: "INFO", Message: tt.msg})
+			if len(ch.lines) != 1 {
+				t.Fatalf("buffered %d lines, want 1", len(ch.lines))
+			}
+			line := ch.lines[0]
+			if len(line) > logConvBatchSize {
+				t.Errorf("line is %d bytes, want at most %d", len(line), logConvBatchSize)
+			}
+			if !utf8.ValidString(line) {
+				t.Errorf("line was cut in the middle of a rune")
+			}
+			if !strings.HasSuffix(line, "...\n") {
+				t.Errorf("truncated line doesn't end with ...")
+			}
+		})
+	}
+}
+
+func TestConvHandlerUsesOutbox(t *testing.T) {
+	var (
+		metrics = &countingMetrics{sends: make(map[string]int)}
+		o       = testOutbox()
+		ch      = &convHandler{
+			ConvID: "logs",
+			KB:     &keybase.Keybase{},
+			Outbox: o,
+			flush:  make(chan struct{}, 1),
+		}
+	)
+	o.bot.Metrics = metrics
+	ch.Handle(logr.Msg{Level: "INFO", Message: "hello"})
+	ch.send()
+	if got := metrics.sends[logConvKind]; got != 1 {
+		t.Errorf("%d log messages were sent through the Outbox, want 1", got)
+	}
+}
@@ -0,0 +1,98 @@
+package keybasebot
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/kf5grd/keybasebot/pkg/util"
+	"samhofi.us/x/keybase/v2/types/chat1"
+)
+
+// MaxMessageLength is the longest message body, in bytes, that the bot will try to send in
+// a single message
+const MaxMessageLength = 10000
+
+// DefaultMaxReplyChunks is the number of messages a long reply is split into before it is
+// uploaded as an attachment instead, when LongReplyOptions.MaxChunks is zero
+const DefaultMaxReplyChunks = 4
+
+// LongReplyOptions controls how Bot.ReplyLong sends a reply
+type LongReplyOptions struct {
+	// The longest message to send. Defaults to MaxMessageLength. Values below
+	// util.MinSplitLength are raised to util.MinSplitLength
+	MaxLength int
+
+	// If the reply would take more than this many messages, it is uploaded as a text file
+	// attachment instead. Defaults to DefaultMaxReplyChunks. Set this to a negative number
+	// to never upload
+	MaxChunks int
+
+	// The name of the uploaded file. Defaults to "reply.txt"
+	Filename string
+
+	// The title shown with the uploaded file
+	Title string
+}
+
+// ReplyLong sends a reply that may be too long for a single message. The body is split into
+// several replies on line boundaries, with code blocks closed and reopened so every message
+// renders correctly. If the body would need more than opts.MaxChunks messages, it is
+// uploaded as a text file attachment instead. See Bot.ReplyFile for when that isn't allowed
+func (b *Bot) ReplyLong(m chat1.MsgSummary, body string, opts LongReplyOptions) error {
+	if opts.MaxLength <= 0 || opts.MaxLength > MaxMessageLength {
+		opts.MaxLength = MaxMessageLength
+	}
+	if opts.MaxChunks == 0 {
+		opts.MaxChunks = DefaultMaxReplyChunks
+	}
+
+	chunks := util.SplitMessage(body, opts.MaxLength)
+	if opts.MaxChunks > 0 && len(chunks) > opts.MaxChunks {
+		b.LoggerFor(m).Debug("Reply to message %d needs %d messages, uploading instead", m.Id, len(chunks))
+		return b.ReplyFile(m, body, opts.Filename, opts.Title)
+	}
+
+	for _, chunk := range chunks {
+		if _, err := b.Reply(m, "%s", chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReplyFile uploads content as a file attachment in the conversation a message was sent in.
+// If filename is empty, "reply.txt" is used. Attachments can't explode, so if the command
+// handling the message has BotCommand.Ephemeral set, ErrExplodingNotAllowed is returned and
+// nothing is uploaded, unless Bot.EphemeralFallback is set
+func (b *Bot) ReplyFile(m chat1.MsgSummary, content, filename, title string) error {
+	if err := b.checkUpload(m); err != nil {
+		return err
+	}
+	if filename == "" {
+		filename = "reply.txt"
+	}
+
+	dir, err := ioutil.TempDir(b.TempDir, "keybasebot-")
+	if err != nil {
+		return fmt.Errorf("unable to create temp directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, filepath.Base(filename))
+	if err := ioutil.WriteFile(file, []byte(content), 0600); err != nil {
+		return fmt.Errorf("unable to write reply file: %w", err)
+	}
+
+	res, err := b.send(m.ConvID, "upload", b.TraceID(m), func() (chat1.SendRes, error) {
+		return b.KB.UploadToConversation(m.ConvID, title, file)
+	})
+	if err != nil {
+		return fmt.Errorf("unable to upload reply file: %w", err)
+	}
+	if res.MessageID != nil {
+		b.replies.add(msgKey{ConvID: m.ConvID, MsgID: m.Id}, *res.MessageID)
+	}
+	return nil
+}
@@ -0,0 +1,24 @@
+package keybasebot
+
+import "time"
+
+// Metrics receives measurements from the bot. Implement this to forward measurements to
+// your metrics system of choice. Implementations must be safe for concurrent use. Tags only
+// ever have a small number of distinct values; trace IDs are kept out of them and are only
+// attached to log messages
+type Metrics interface {
+	// Count adds delta to the named counter
+	Count(name string, delta int64, tags map[string]string)
+
+	// Timing records how long something took
+	Timing(name string, d time.Duration, tags map[string]string)
+}
+
+// NopMetrics is a Metrics that discards everything. This is the default
+type NopMetrics struct{}
+
+// Count does nothing
+func (NopMetrics) Count(string, int64, map[string]string) {}
+
+// Timing does nothing
+func (NopMetrics) Timing(string, time.Duration, map[string]string) {}
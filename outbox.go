@@ -0,0 +1,286 @@
+package keybasebot
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"samhofi.us/x/keybase/v2/types/chat1"
+)
+
+// These are the default settings for a new Outbox
+const (
+	DefaultOutboxGlobalInterval = 100 * time.Millisecond
+	DefaultOutboxConvInterval   = 500 * time.Millisecond
+	DefaultOutboxMaxRetries     = 3
+	DefaultOutboxBackoff        = time.Second
+)
+
+// outboxQueueSize is how many sends can be waiting for a single conversation before new
+// sends block
+const outboxQueueSize = 100
+
+// outboxIdleTimeout is how long a conversation's worker waits for new sends before exiting
+const outboxIdleTimeout = time.Minute
+
+// retryableKinds are the kinds of send that can safely be made more than once. A failed
+// send may still have reached the Keybase service, so retrying a reply or an upload could
+// post it twice, and reacting again would toggle the reaction back off. Editing or deleting
+// again changes nothing
+var retryableKinds = map[string]bool{
+	"edit":   true,
+	"delete": true,
+}
+
+// SendFunc performs a single send to the Keybase service, such as a call to
+// Bot.KB.SendMessageByConvID
+type SendFunc func() (chat1.SendRes, error)
+
+// outboxJob is a single send waiting in the Outbox
+type outboxJob struct {
+	conv   chat1.ConvIDStr
+	kind   string
+	trace  string
+	send   SendFunc
+	result chan outboxResult
+}
+
+type outboxResult struct {
+	res chat1.SendRes
+	err error
+}
+
+// Outbox queues everything the bot sends. Sends to the same conversation are made in the
+// order they were queued, and the Outbox waits between sends so the bot doesn't run into
+// the Keybase rate limits. Sends that fail are retried with an increasing delay, and sends
+// that still fail after every retry are reported to the logger and to Bot.Metrics (apart
+// from sends to Bot.LogConv, which would only log more lines to the same place). Only
+// edits and deletes are retried, since repeating any other send could post it twice, or
+// undo a reaction
+type Outbox struct {
+	// The minimum time between any two sends, regardless of conversation
+	GlobalInterval time.Duration
+
+	// The minimum time between two sends to the same conversation
+	ConvInterval time.Duration
+
+	// How many times a failed send is retried before giving up
+	MaxRetries int
+
+	// How long to wait before the first retry. This is doubled after every retry
+	Backoff time.Duration
+
+	// IsTransient decides whether a failed send is worth retrying. If this is nil, every
+	// error is retried unless it looks like a permission or validation problem
+	IsTransient func(error) bool
+
+	bot      *Bot
+	mu       sync.Mutex
+	queues   map[chat1.ConvIDStr]chan *outboxJob
+	pending  map[chat1.ConvIDStr]int
+	nextSend time.Time
+
+	// idleTimeout is how long a conversation's worker waits for new sends before exiting
+	idleTimeout time.Duration
+}
+
+// newOutbox returns an Outbox with the default settings
+func newOutbox(b *Bot) *Outbox {
+	return &Outbox{
+		GlobalInterval: DefaultOutboxGlobalInterval,
+		ConvInterval:   DefaultOutboxConvInterval,
+		MaxRetries:     DefaultOutboxMaxRetries,
+		Backoff:        DefaultOutboxBackoff,
+		bot:            b,
+		queues:         make(map[chat1.ConvIDStr]chan *outboxJob),
+		pending:        make(map[chat1.ConvIDStr]int),
+		idleTimeout:    outboxIdleTimeout,
+	}
+}
+
+// permanentErrors are substrings of errors that will not go away by retrying
+var permanentErrors = []string{
+	"not a member",
+	"permission",
+	"not found",
+	"invalid",
+	"too long",
+}
+
+// isTransient is the default IsTransient
+func isTransient(err error) bool {
+	msg := strings.ToLower(err.Error())
+	for _, permanent := range permanentErrors {
+		if strings.Contains(msg, permanent) {
+			return false
+		}
+	}
+	return true
+}
+
+// SendOption changes how a single send is made
+type SendOption func(*outboxJob)
+
+// WithTraceID attaches a trace ID to a send's log messages. See Bot.TraceID
+func WithTraceID(trace string) SendOption {
+	return func(job *outboxJob) {
+		job.trace = trace
+	}
+}
+
+// newJob returns a job for the Outbox with the given options applied
+func newJob(conv chat1.ConvIDStr, kind string, send SendFunc, opts []SendOption) *outboxJob {
+	job := &outboxJob{
+		conv:   conv,
+		kind:   kind,
+		send:   send,
+		result: make(chan outboxResult, 1),
+	}
+	for _, opt := range opts {
+		opt(job)
+	}
+	return job
+}
+
+// Send queues a send for a conversation and waits for it to finish. kind describes the send
+// (e.g. "reply" or "reaction") for logs and metrics
+func (o *Outbox) Send(conv chat1.ConvIDStr, kind string, send SendFunc, opts ...SendOption) (chat1.SendRes, error) {
+	job := newJob(conv, kind, send, opts)
+	o.enqueue(job)
+	r := <-job.result
+	return r.res, r.err
+}
+
+// SendAsync queues a send for a conversation without waiting for it to finish
+func (o *Outbox) SendAsync(conv chat1.ConvIDStr, kind string, send SendFunc, opts ...SendOption) {
+	o.enqueue(newJob(conv, kind, send, opts))
+}
+
+// enqueue adds a job to its conversation's queue, and starts a worker for the conversation
+// if one isn't running. The job is counted as pending before the lock is released, so the
+// worker can't decide it's idle and exit before the job reaches the queue
+func (o *Outbox) enqueue(job *outboxJob) {
+	o.mu.Lock()
+	queue, ok := o.queues[job.conv]
+	if !ok {
+		queue = make(chan *outboxJob, outboxQueueSize)
+		o.queues[job.conv] = queue
+		go o.worker(job.conv, queue)
+	}
+	o.pending[job.conv]++
+	o.mu.Unlock()
+	queue <- job
+}
+
+// worker sends the queued jobs for a single conversation, one at a time, until the queue
+// has been idle for a while
+func (o *Outbox) worker(conv chat1.ConvIDStr, queue chan *outboxJob) {
+	idle := time.NewTimer(o.idleTimeout)
+	defer idle.Stop()
+	for {
+		select {
+		case job := <-queue:
+			o.mu.Lock()
+			o.pending[conv]--
+			o.mu.Unlock()
+			res, err := o.process(job)
+			job.result <- outboxResult{res: res, err: err}
+			time.Sleep(o.ConvInterval)
+		case <-idle.C:
+			o.mu.Lock()
+			if o.pending[conv] == 0 {
+				delete(o.queues, conv)
+				delete(o.pending, conv)
+				o.mu.Unlock()
+				return
+			}
+			o.mu.Unlock()
+		}
+		if !idle.Stop() {
+			select {
+			case <-idle.C:
+			default:
+			}
+		}
+		idle.Reset(o.idleTimeout)
+	}
+}
+
+// wait blocks until the global rate limit allows another send
+func (o *Outbox) wait() {
+	o.mu.Lock()
+	now := time.Now()
+	next := o.nextSend
+	if next.Before(now) {
+		next = now
+	}
+	o.nextSend = next.Add(o.GlobalInterval)
+	o.mu.Unlock()
+	time.Sleep(time.Until(next))
+}
+
+// process sends a single job, retrying it if necessary
+func (o *Outbox) process(job *outboxJob) (chat1.SendRes, error) {
+	var (
+		b         = o.bot
+		logger    = b.Logger.WithComponent("outbox").With("conv_id", job.conv)
+		tags      = map[string]string{"kind": job.kind}
+		transient = o.IsTransient
+		backoff   = o.Backoff
+		start     = time.Now()
+		report    = job.kind != logConvKind
+		res       chat1.SendRes
+		err       error
+	)
+	if transient == nil {
+		transient = isTransient
+	}
+	if job.trace != "" {
+		logger = logger.With("trace_id", job.trace)
+	}
+
+	for attempt := 0; ; attempt++ {
+		o.wait()
+		res, err = job.send()
+		if err == nil {
+			b.Metrics.Count("outbox.sent", 1, tags)
+			b.Metrics.Timing("outbox.latency", time.Since(start), tags)
+			return res, nil
+		}
+		if attempt >= o.MaxRetries || !retryableKinds[job.kind] || !transient(err) {
+			break
+		}
+
+		logger.Warn("Unable to send %s, retrying in %v: %v", job.kind, backoff, err)
+		b.Metrics.Count("outbox.retried", 1, tags)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+
+	if report {
+		logger.Error("Giving up on sending %s: %v", job.kind, err)
+	}
+	b.Metrics.Count("outbox.failed", 1, tags)
+	return res, err
+}
+
+// send queues a send with the Outbox, tagged with a trace ID, and waits for it to finish
+func (b *Bot) send(conv chat1.ConvIDStr, kind, trace string, send SendFunc) (chat1.SendRes, error) {
+	return b.Outbox.Send(conv, kind, send, WithTraceID(trace))
+}
+
+// sendAsync queues a send with the Outbox, tagged with a trace ID, without waiting for it
+// to finish
+func (b *Bot) sendAsync(conv chat1.ConvIDStr, kind, trace string, send SendFunc) {
+	b.Outbox.SendAsync(conv, kind, send, WithTraceID(trace))
+}
+
+// SendMessage sends a message to a conversation through the Outbox, and waits for it to be
+// sent
+func (b *Bot) SendMessage(conv chat1.ConvIDStr, message string, a ...interface{}) (chat1.SendRes, error) {
+	body := fmt.Sprintf(message, a...)
+	return b.send(conv, "message", "", func() (chat1.SendRes, error) {
+		return b.KB.SendMessageByConvID(conv, "%s", body)
+	})
+}
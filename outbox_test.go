@@ -0,0 +1,167 @@
+package keybasebot
+
+import (
+	"errors"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kf5grd/keybasebot/pkg/logr"
+	"samhofi.us/x/keybase/v2/types/chat1"
+)
+
+// testOutbox returns an Outbox that doesn't wait between sends or retries
+func testOutbox() *Outbox {
+	b := &Bot{
+		Logger:  logr.New(ioutil.Discard, false, false),
+		Metrics: NopMetrics{},
+	}
+	o := newOutbox(b)
+	o.GlobalInterval = 0
+	o.ConvInterval = 0
+	o.Backoff = time.Millisecond
+	b.Outbox = o
+	return o
+}
+
+func TestOutboxRetries(t *testing.T) {
+	tests := []struct {
+		name      string
+		kind      string
+		err       error
+		wantCalls int
+	}{
+		{"edit is retried", "edit", errors.New("connection reset"), DefaultOutboxMaxRetries + 1},
+		{"delete is retried", "delete", errors.New("timeout"), DefaultOutboxMaxRetries + 1},
+		{"reaction is not retried", "reaction", errors.New("timeout"), 1},
+		{"reply is not retried", "reply", errors.New("timeout"), 1},
+		{"upload is not retried", "upload", errors.New("timeout"), 1},
+		{"permanent error", "edit", errors.New("permission denied"), 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := testOutbox()
+			calls := 0
+			_, err := o.Send("conv", tt.kind, func() (chat1.SendRes, error) {
+				calls++
+				return chat1.SendRes{}, tt.err
+			})
+			if err != tt.err {
+				t.Errorf("Send returned %v, want %v", err, tt.err)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("send was called %d times, want %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestOutboxOrder(t *testing.T) {
+	o := testOutbox()
+	var (
+		mu   sync.Mutex
+		got  []int
+		wg   sync.WaitGroup
+		want = 20
+	)
+	wg.Add(want)
+	for i := 0; i < want; i++ {
+		i := i
+		o.SendAsync("conv", "message", func() (chat1.SendRes, error) {
+			defer wg.Done()
+			mu.Lock()
+			got = append(got, i)
+			mu.Unlock()
+			return chat1.SendRes{}, nil
+		})
+	}
+	wg.Wait()
+	for i, v := range got {
+		if v != i {
+			t.Fatalf("sends were made out of order: %v", got)
+		}
+	}
+}
+
+func TestOutboxIdleWorker(t *testing.T) {
+	// sends racing with the worker's idle exit must never be lost
+	o := testOutbox()
+	o.idleTimeout = time.Millisecond
+	for i := 0; i < 200; i++ {
+		done := make(chan struct{})
+		go func() {
+			o.Send("conv", "message", func() (chat1.SendRes, error) {
+				return chat1.SendRes{}, nil
+			})
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("send %d was never processed", i)
+		}
+		time.Sleep(time.Duration(i%3) * time.Millisecond)
+	}
+}
+
+// tagMetrics records the tags of every measurement
+type tagMetrics struct {
+	mu   sync.Mutex
+	tags []map[string]string
+}
+
+func (m *tagMetrics) Count(_ string, _ int64, tags map[string]string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.tags = append(m.tags, tags)
+}
+
+func (m *tagMetrics) Timing(_ string, _ time.Duration, tags map[string]string) {
+	m.Count("", 0, tags)
+}
+
+func TestOutboxTrace(t *testing.T) {
+	tests := []struct {
+		name  string
+		opts  []SendOption
+		trace string
+	}{
+		{"no trace", nil, ""},
+		{"with trace", []SendOption{WithTraceID("abc123")}, "abc123"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				o       = testOutbox()
+				metrics = &tagMetrics{}
+				logs    = logr.NewRingBuffer(10, logr.LevelUnknown)
+			)
+			o.bot.Metrics = metrics
+			o.bot.Logger.Handler = logs
+			o.Send("conv", "reply", func() (chat1.SendRes, error) {
+				return chat1.SendRes{}, errors.New("not a member")
+			}, tt.opts...)
+
+			for _, tags := range metrics.tags {
+				if _, ok := tags["trace_id"]; ok {
+					t.Errorf("metric tags include trace_id: %v", tags)
+				}
+			}
+			msgs := logs.Messages()
+			if len(msgs) == 0 {
+				t.Fatal("the failed send wasn't logged")
+			}
+			if got, _ := msgs[0].Fields["trace_id"].(string); got != tt.trace {
+				t.Errorf("trace_id = %q, want %q", got, tt.trace)
+			}
+			if got, _ := msgs[0].Fields["conv_id"].(chat1.ConvIDStr); got != "conv" {
+				t.Errorf("conv_id = %q, want %q", got, "conv")
+			}
+			if strings.Contains(msgs[0].Message, "conv") {
+				t.Errorf("the conversation ID is in the message text: %q", msgs[0].Message)
+			}
+		})
+	}
+}
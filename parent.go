@@ -0,0 +1,177 @@
+package keybasebot
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/kf5grd/keybasebot/pkg/logr"
+	"samhofi.us/x/keybase/v2/types/chat1"
+)
+
+// defaultMaxCachedParents is the number of parent messages we keep in memory before we start
+// forgetting the oldest ones
+const defaultMaxCachedParents = 200
+
+// ErrNoParent is returned by Bot.ParentMessage when a message is not a reply to another
+// message
+var ErrNoParent = errors.New("message is not a reply")
+
+// ParentAction is like a BotAction, but also receives the message that the triggering
+// message was a reply to
+type ParentAction func(m chat1.MsgSummary, parent chat1.MsgSummary, b *Bot) (bool, error)
+
+// messageCache is a bounded cache of messages
+type messageCache struct {
+	mu       sync.Mutex
+	max      int
+	order    []msgKey
+	messages map[msgKey]chat1.MsgSummary
+}
+
+func newMessageCache(max int) *messageCache {
+	return &messageCache{
+		max:      max,
+		order:    make([]msgKey, 0),
+		messages: make(map[msgKey]chat1.MsgSummary),
+	}
+}
+
+func (c *messageCache) get(key msgKey) (chat1.MsgSummary, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	m, ok := c.messages[key]
+	return m, ok
+}
+
+func (c *messageCache) put(key msgKey, m chat1.MsgSummary) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.messages[key]; !ok {
+		c.order = append(c.order, key)
+	}
+	c.messages[key] = m
+	for len(c.order) > c.max {
+		delete(c.messages, c.order[0])
+		c.order = c.order[1:]
+	}
+}
+
+func (c *messageCache) remove(key msgKey) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.messages[key]; !ok {
+		return
+	}
+	delete(c.messages, key)
+	for i, k := range c.order {
+		if k == key {
+			c.order = append(c.order[:i], c.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// ParentID returns the ID of the message that m is a reply to. If m is not a reply, false is
+// returned
+func ParentID(m chat1.MsgSummary) (chat1.MessageID, bool) {
+	if m.Content.Text == nil || m.Content.Text.ReplyTo == nil {
+		return 0, false
+	}
+	return *m.Content.Text.ReplyTo, true
+}
+
+// ParentMessage fetches the message that m is a reply to. Fetched messages are cached, so
+// calling this more than once for the same message is cheap. If m is not a reply,
+// ErrNoParent is returned
+func (b *Bot) ParentMessage(m chat1.MsgSummary) (chat1.MsgSummary, error) {
+	id, ok := ParentID(m)
+	if !ok {
+		return chat1.MsgSummary{}, ErrNoParent
+	}
+
+	parent, err := b.fetchMessage(b.LoggerFor(m), m.ConvID, id)
+	if err != nil {
+		return chat1.MsgSummary{}, fmt.Errorf("unable to fetch parent message: %w", err)
+	}
+	return parent, nil
+}
+
+// fetchMessage fetches a message from a conversation. Fetched messages are cached until they
+// are edited or deleted. logger should be the logger for the message being handled, so the
+// lines logged here keep its trace ID and level
+func (b *Bot) fetchMessage(logger *logr.Logger, conv chat1.ConvIDStr, id chat1.MessageID) (chat1.MsgSummary, error) {
+	key := msgKey{ConvID: conv, MsgID: id}
+	if msg, ok := b.parents.get(key); ok {
+		logger.Debug("Found message %d in cache", id)
+		return msg, nil
+	}
+
+	logger.Debug("Fetching message %d", id)
+	var (
+		thread  chat1.Thread
+		options = struct {
+			ConversationID chat1.ConvIDStr   `json:"conversation_id"`
+			MessageIDs     []chat1.MessageID `json:"message_ids"`
+		}{conv, []chat1.MessageID{id}}
+	)
+	if err := b.chatAPI("get", options, &thread); err != nil {
+		return chat1.MsgSummary{}, err
+	}
+	if len(thread.Messages) == 0 || thread.Messages[0].Msg == nil {
+		if len(thread.Messages) > 0 && thread.Messages[0].Error != nil {
+			return chat1.MsgSummary{}, errors.New(*thread.Messages[0].Error)
+		}
+		return chat1.MsgSummary{}, fmt.Errorf("message %d not found", id)
+	}
+
+	msg := *thread.Messages[0].Msg
+	b.parents.put(key, msg)
+	return msg, nil
+}
+
+// forgetMessages removes edited and deleted messages from the message cache, so they are
+// fetched again the next time they're needed
+func (b *Bot) forgetMessages(m chat1.MsgSummary) {
+	switch {
+	case m.Content.Edit != nil:
+		b.parents.remove(msgKey{ConvID: m.ConvID, MsgID: m.Content.Edit.MessageID})
+	case m.Content.Delete != nil:
+		for _, id := range m.Content.Delete.MessageIDs {
+			b.parents.remove(msgKey{ConvID: m.ConvID, MsgID: id})
+		}
+	}
+}
+
+// RequireReply returns an Adapter that only runs a command when the message is a reply to
+// another message. If it isn't, the bot replies with the given usage string. The parent
+// message is fetched and cached, so the command can get it with Bot.ParentMessage without
+// another round trip
+func RequireReply(usage string) Adapter {
+	return func(botAction BotAction) BotAction {
+		return func(m chat1.MsgSummary, b *Bot) (bool, error) {
+			b.LoggerFor(m).Debug("Verifying message is a reply")
+			if _, err := b.ParentMessage(m); err != nil {
+				if err == ErrNoParent {
+					b.LoggerFor(m).Debug("Message is not a reply, exiting command and replying with usage")
+					return true, NewUserError(usage, nil)
+				}
+				return true, b.LocalizedError(m, err, MsgParentFetchFailed)
+			}
+			b.LoggerFor(m).Debug("Message is a reply, continuing")
+			return botAction(m, b)
+		}
+	}
+}
+
+// WithParent turns a ParentAction into a BotAction. When the triggering message is not a
+// reply, the bot replies with the given usage string
+func WithParent(usage string, parentAction ParentAction) BotAction {
+	return Adapt(func(m chat1.MsgSummary, b *Bot) (bool, error) {
+		parent, err := b.ParentMessage(m)
+		if err != nil {
+			return true, err
+		}
+		return parentAction(m, parent, b)
+	}, RequireReply(usage))
+}
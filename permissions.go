@@ -0,0 +1,180 @@
+package keybasebot
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/kf5grd/keybasebot/pkg/kvstore"
+	"github.com/kf5grd/keybasebot/pkg/logr"
+	"github.com/kf5grd/keybasebot/pkg/util"
+	"samhofi.us/x/keybase/v2/types/chat1"
+)
+
+// DefaultPermissionNamespace is the kvstore namespace used for permission groups when
+// Bot.PermissionNamespace is not changed
+const DefaultPermissionNamespace = "keybasebot-permissions"
+
+// PermissionAdmin is the permission required to use the commands returned by
+// PermissionCommands
+const PermissionAdmin = "permissions"
+
+// HasPermission returns true if the user has been granted the permission, or if the user has
+// at least the Bot.PermissionBootstrapRole in the Bot.PermissionBootstrapTeam. The
+// conversation the message was sent in is never used for the bootstrap check, since every
+// member of a direct message is an owner of it
+func (b *Bot) HasPermission(m chat1.MsgSummary, user, permission string) (bool, error) {
+	if b.PermissionBootstrapTeam != "" && b.PermissionBootstrapRole != "" &&
+		util.HasMinTeamRole(b.KB, b.PermissionBootstrapRole, user, b.PermissionBootstrapTeam) {
+		b.LoggerFor(m).WithFields(logr.Fields{"user": user, "team": b.PermissionBootstrapTeam}).Debug("User has bootstrap role '%s', granting permission '%s'", b.PermissionBootstrapRole, permission)
+		return true, nil
+	}
+	return kvstore.InGroup(b.KB, b.PermissionTeam, b.PermissionNamespace, permission, user)
+}
+
+// RequirePermission returns an Adapter that restricts a command to users who have been
+// granted the specified permission. Users with at least the Bot.PermissionBootstrapRole in
+// the Bot.PermissionBootstrapTeam are always allowed. Note that this _must_ be called
+// _after_ CommandPrefix because this assumes that we already know we're executing the
+// provided command.
+func RequirePermission(permission string) Adapter {
+	return func(botAction BotAction) BotAction {
+		return func(m chat1.MsgSummary, b *Bot) (bool, error) {
+			b.LoggerFor(m).Debug("Verifying sender has permission '%s'", permission)
+			ok, err := b.HasPermission(m, m.Sender.Username, permission)
+			if err != nil {
+				return true, b.LocalizedError(m, fmt.Errorf("unable to look up permission '%s': %w", permission, err), MsgPermissionLookupFailed)
+			}
+			if !ok {
+				b.LoggerFor(m).Debug("Sender does not have permission '%s', exiting command and replying with error", permission)
+				return true, b.Errorf(m, MsgPermissionDenied, permission)
+			}
+			b.LoggerFor(m).Debug("Sender has permission '%s', continuing", permission)
+			return botAction(m, b)
+		}
+	}
+}
+
+// PermissionCommands returns a set of BotCommands that allow users with the PermissionAdmin
+// permission to grant, revoke, and list permissions. Each command will be triggered by
+// prefix followed by the command name, e.g. "!grant", "!revoke", and "!permissions" when
+// prefix is "!"
+func PermissionCommands(prefix string) []BotCommand {
+	return []BotCommand{
+		{
+			Name: "GrantPermission",
+			Ad: &chat1.UserBotCommandInput{
+				Name:        "grant",
+				Usage:       "<permission> <user> [user...]",
+				Description: "Grant a permission to one or more users",
+			},
+			Run: Adapt(cmdGrantPermission(prefix+"grant"),
+				MessageType("text"),
+				CommandPrefix(prefix+"grant"),
+				RequirePermission(PermissionAdmin),
+			),
+		},
+		{
+			Name: "RevokePermission",
+			Ad: &chat1.UserBotCommandInput{
+				Name:        "revoke",
+				Usage:       "<permission> <user> [user...]",
+				Description: "Revoke a permission from one or more users",
+			},
+			Run: Adapt(cmdRevokePermission(prefix+"revoke"),
+				MessageType("text"),
+				CommandPrefix(prefix+"revoke"),
+				RequirePermission(PermissionAdmin),
+			),
+		},
+		{
+			Name: "ListPermissions",
+			Ad: &chat1.UserBotCommandInput{
+				Name:        "permissions",
+				Usage:       "[permission]",
+				Description: "List permissions and the users who have been granted them",
+			},
+			Run: Adapt(cmdListPermissions(prefix+"permissions"),
+				MessageType("text"),
+				CommandPrefix(prefix+"permissions"),
+				RequirePermission(PermissionAdmin),
+			),
+		},
+	}
+}
+
+// permissionArgs splits the arguments for the grant and revoke commands into the permission
+// name and the list of users
+func permissionArgs(m chat1.MsgSummary, b *Bot, command string) (string, []string, error) {
+	args := strings.Fields(strings.TrimPrefix(m.Content.Text.Body, command))
+	if len(args) < 2 {
+		return "", nil, b.Errorf(m, MsgPermissionUsage, command)
+	}
+
+	users := make([]string, 0)
+	for _, user := range args[1:] {
+		users = append(users, strings.TrimPrefix(user, "@"))
+	}
+	return strings.ToLower(args[0]), users, nil
+}
+
+func cmdGrantPermission(command string) BotAction {
+	return func(m chat1.MsgSummary, b *Bot) (bool, error) {
+		permission, users, err := permissionArgs(m, b, command)
+		if err != nil {
+			return true, err
+		}
+		if err := kvstore.AddToGroup(b.KB, b.PermissionTeam, b.PermissionNamespace, permission, users...); err != nil {
+			return true, b.LocalizedError(m, err, MsgPermissionGrantFailed, permission)
+		}
+		b.LoggerFor(m).With("users", strings.Join(users, ",")).Info("Sender granted permission '%s'", permission)
+		b.React(m, ":heavy_check_mark:")
+		return true, nil
+	}
+}
+
+func cmdRevokePermission(command string) BotAction {
+	return func(m chat1.MsgSummary, b *Bot) (bool, error) {
+		permission, users, err := permissionArgs(m, b, command)
+		if err != nil {
+			return true, err
+		}
+		if err := kvstore.RemoveFromGroup(b.KB, b.PermissionTeam, b.PermissionNamespace, permission, users...); err != nil {
+			return true, b.LocalizedError(m, err, MsgPermissionRevokeFailed, permission)
+		}
+		b.LoggerFor(m).With("users", strings.Join(users, ",")).Info("Sender revoked permission '%s'", permission)
+		b.React(m, ":heavy_check_mark:")
+		return true, nil
+	}
+}
+
+func cmdListPermissions(command string) BotAction {
+	return func(m chat1.MsgSummary, b *Bot) (bool, error) {
+		permissions := strings.Fields(strings.TrimPrefix(m.Content.Text.Body, command))
+		if len(permissions) == 0 {
+			var err error
+			permissions, err = kvstore.Groups(b.KB, b.PermissionTeam, b.PermissionNamespace)
+			if err != nil {
+				return true, b.LocalizedError(m, err, MsgPermissionListFailed)
+			}
+		}
+		if len(permissions) == 0 {
+			b.Reply(m, "%s", b.T(m, MsgPermissionNone))
+			return true, nil
+		}
+
+		lines := make([]string, 0)
+		for _, permission := range permissions {
+			group, err := kvstore.GetGroup(b.KB, b.PermissionTeam, b.PermissionNamespace, permission)
+			if err != nil {
+				return true, b.LocalizedError(m, err, MsgPermissionListFailed)
+			}
+			members := "_none_"
+			if len(group.Members) > 0 {
+				members = strings.Join(group.Members, ", ")
+			}
+			lines = append(lines, fmt.Sprintf("*%s*: %s", group.Name, members))
+		}
+		b.Reply(m, "%s", strings.Join(lines, "\n"))
+		return true, nil
+	}
+}
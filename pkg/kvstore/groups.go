@@ -0,0 +1,118 @@
+package kvstore
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"samhofi.us/x/keybase/v2"
+)
+
+// Groups returns a slice of strings containing the names of all the groups stored in a
+// namespace
+func Groups(kb *keybase.Keybase, team, namespace string) ([]string, error) {
+	return Keys(kb, team, namespace)
+}
+
+// maxGroupUpdates is how many times AddToGroup and RemoveFromGroup try to update a group
+// that keeps being changed by someone else
+const maxGroupUpdates = 5
+
+// GetGroup fetches a group from the store. If the group does not exist, an empty group is
+// returned
+func GetGroup(kb *keybase.Keybase, team, namespace, name string) (Group, error) {
+	group, _, err := getGroup(kb, team, namespace, name)
+	return group, err
+}
+
+// getGroup fetches a group from the store along with its revision
+func getGroup(kb *keybase.Keybase, team, namespace, name string) (Group, int, error) {
+	group := Group{Name: strings.ToLower(name), Members: make([]string, 0)}
+	revision, err := GetWithRevision(kb, team, namespace, &KV{Key: group.Name, Value: &group})
+	if err == ErrNotFound {
+		return group, revision, nil
+	}
+	if err != nil {
+		return Group{}, 0, err
+	}
+	return group, revision, nil
+}
+
+// PutGroup writes a group to the store. Groups with no members are deleted from the store
+func PutGroup(kb *keybase.Keybase, team, namespace string, group Group) error {
+	return putGroup(kb, team, namespace, group, -1)
+}
+
+// putGroup writes a group to the store with the given revision, or without a revision if it
+// is negative
+func putGroup(kb *keybase.Keybase, team, namespace string, group Group, revision int) error {
+	group.Name = strings.ToLower(group.Name)
+	if len(group.Members) == 0 {
+		return Delete(kb, team, namespace, New(group.Name, nil, revision))
+	}
+	sort.Strings(group.Members)
+	return Put(kb, team, namespace, New(group.Name, group, revision))
+}
+
+// updateGroup applies update to a group and writes it back to the store. If the group was
+// changed by someone else in the meantime, the update is tried again with the new group
+func updateGroup(kb *keybase.Keybase, team, namespace, name string, update func(*Group)) error {
+	var err error
+	for attempt := 0; attempt < maxGroupUpdates; attempt++ {
+		var (
+			group    Group
+			revision int
+		)
+		group, revision, err = getGroup(kb, team, namespace, name)
+		if err != nil {
+			return err
+		}
+		update(&group)
+		err = putGroup(kb, team, namespace, group, revision+1)
+		if !IsConflict(err) {
+			return err
+		}
+	}
+	return fmt.Errorf("%w: %v", ErrConflict, err)
+}
+
+// AddToGroup adds one or more users to a group, creating the group if it doesn't exist
+func AddToGroup(kb *keybase.Keybase, team, namespace, name string, users ...string) error {
+	return updateGroup(kb, team, namespace, name, func(group *Group) {
+		for _, user := range users {
+			if !group.HasMember(user) {
+				group.Members = append(group.Members, strings.ToLower(user))
+			}
+		}
+	})
+}
+
+// RemoveFromGroup removes one or more users from a group. The group will be deleted if it
+// has no members left
+func RemoveFromGroup(kb *keybase.Keybase, team, namespace, name string, users ...string) error {
+	return updateGroup(kb, team, namespace, name, func(group *Group) {
+		members := make([]string, 0)
+		for _, member := range group.Members {
+			var remove bool
+			for _, user := range users {
+				if strings.EqualFold(member, user) {
+					remove = true
+					break
+				}
+			}
+			if !remove {
+				members = append(members, member)
+			}
+		}
+		group.Members = members
+	})
+}
+
+// InGroup returns true if the user is a member of the group
+func InGroup(kb *keybase.Keybase, team, namespace, name, user string) (bool, error) {
+	group, err := GetGroup(kb, team, namespace, name)
+	if err != nil {
+		return false, err
+	}
+	return group.HasMember(user), nil
+}
@@ -3,11 +3,20 @@ package kvstore
 import (
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
 
 	"samhofi.us/x/keybase/v2"
 )
 
+// ErrNotFound is returned by Get when the requested key does not exist in the store
+var ErrNotFound = errors.New("key not found in store")
+
+// ErrConflict is returned when a key could not be updated because it kept being changed by
+// someone else
+var ErrConflict = errors.New("key was changed by someone else")
+
 // Namespaces returns a slice of strings containing all the namespaces for a team
 func Namespaces(kb *keybase.Keybase, team string) ([]string, error) {
 	var teamName *string
@@ -47,8 +56,18 @@ func Keys(kb *keybase.Keybase, team, namespace string) ([]string, error) {
 	return ret, nil
 }
 
-// Get fetches a key from the store
+// Get fetches a key from the store. If the key does not exist, or has been deleted,
+// ErrNotFound is returned
 func Get(kb *keybase.Keybase, team, namespace string, kv *KV) error {
+	_, err := GetWithRevision(kb, team, namespace, kv)
+	return err
+}
+
+// GetWithRevision fetches a key from the store, and returns the key's current revision. To
+// update the key without overwriting someone else's change, Put it with the revision plus
+// one. If the key does not exist, or has been deleted, ErrNotFound is returned along with
+// the revision
+func GetWithRevision(kb *keybase.Keybase, team, namespace string, kv *KV) (int, error) {
 	var teamName *string
 
 	teamName = &team
@@ -59,18 +78,35 @@ func Get(kb *keybase.Keybase, team, namespace string, kv *KV) error {
 	key := base64.StdEncoding.EncodeToString([]byte(kv.Key))
 	val, err := kb.KVGet(teamName, namespace, key)
 	if err != nil {
-		return fmt.Errorf("unable to fetch key from store: %v", err)
+		return 0, fmt.Errorf("unable to fetch key from store: %w", err)
+	}
+	if val.EntryValue == "" {
+		return val.Revision, ErrNotFound
 	}
 
 	value, err := base64.StdEncoding.DecodeString(val.EntryValue)
 	if err != nil {
-		return fmt.Errorf("unable to base64 decode value data from store: %v", err)
+		return val.Revision, fmt.Errorf("unable to base64 decode value data from store: %w", err)
 	}
 	err = json.Unmarshal(value, kv.Value)
 	if err != nil {
-		return fmt.Errorf("unable to unmarshal value data from store: %v", err)
+		return val.Revision, fmt.Errorf("unable to unmarshal value data from store: %w", err)
 	}
-	return nil
+	return val.Revision, nil
+}
+
+// IsConflict returns true if a Put or Delete with a revision failed because the key was
+// changed since its revision was fetched
+func IsConflict(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, ErrConflict) {
+		return true
+	}
+
+	// the keybase client doesn't return typed errors, so the message is all we have
+	return strings.Contains(strings.ToLower(err.Error()), "revision")
 }
 
 // Put writes a key to the store
@@ -88,7 +124,7 @@ func Put(kb *keybase.Keybase, team, namespace string, kv KV) error {
 	// base64 encode value
 	jsonBytes, err := json.Marshal(kv.Value)
 	if err != nil {
-		return fmt.Errorf("unable to marshal value data: %v", err)
+		return fmt.Errorf("unable to marshal value data: %w", err)
 	}
 	value := base64.StdEncoding.EncodeToString(jsonBytes)
 
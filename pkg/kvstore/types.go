@@ -1,5 +1,7 @@
 package kvstore
 
+import "strings"
+
 // KV holds a key/value pair for use with the kvstore. The Value will be marshaled to and
 // from JSON.
 type KV struct {
@@ -23,3 +25,20 @@ func New(key string, value interface{}, revision int) KV {
 	return kv
 
 }
+
+// Group holds a named group of users, such as the members who have been granted a
+// particular permission. Usernames are stored in lowercase.
+type Group struct {
+	Name    string   `json:"name"`
+	Members []string `json:"members"`
+}
+
+// HasMember returns true if the user is a member of the group
+func (g Group) HasMember(user string) bool {
+	for _, member := range g.Members {
+		if strings.EqualFold(member, user) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,132 @@
+package logr
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Fields holds structured key/value pairs that are attached to log messages
+type Fields map[string]interface{}
+
+// reservedKeys are the keys used by Msg itself. Fields with these keys are renamed when a
+// Msg is marshaled to JSON
+var reservedKeys = map[string]struct{}{
+	"time":      {},
+	"component": {},
+	"func_name": {},
+	"level":     {},
+	"message":   {},
+}
+
+// WithFields returns a copy of the Logger that attaches the given fields to every message
+// it writes, in addition to any fields the Logger already had
+func (l *Logger) WithFields(fields Fields) *Logger {
+	c := *l
+	c.fields = make(Fields, len(l.fields)+len(fields))
+	for k, v := range l.fields {
+		c.fields[k] = v
+	}
+	for k, v := range fields {
+		c.fields[k] = v
+	}
+	return &c
+}
+
+// With returns a copy of the Logger that attaches a single field to every message it writes
+func (l *Logger) With(key string, value interface{}) *Logger {
+	return l.WithFields(Fields{key: value})
+}
+
+// Fields returns a copy of the fields the Logger attaches to every message
+func (l *Logger) Fields() Fields {
+	f := make(Fields, len(l.fields))
+	for k, v := range l.fields {
+		f[k] = v
+	}
+	return f
+}
+
+// fieldValue converts values that don't marshal in a useful way, like errors and durations,
+// into strings
+func fieldValue(v interface{}) interface{} {
+	switch value := v.(type) {
+	case error:
+		return value.Error()
+	case time.Duration:
+		return value.String()
+	case fmt.Stringer:
+		return value.String()
+	}
+	return v
+}
+
+// sortedKeys returns the keys of the fields in order
+func (f Fields) sortedKeys() []string {
+	keys := make([]string, 0, len(f))
+	for k := range f {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// String returns the fields formatted as key=value pairs, in order by key. Values containing
+// spaces or quotes are quoted
+func (f Fields) String() string {
+	pairs := make([]string, 0, len(f))
+	for _, k := range f.sortedKeys() {
+		v := fmt.Sprint(fieldValue(f[k]))
+		if v == "" || strings.ContainsAny(v, " \t\n\"=") {
+			v = strconv.Quote(v)
+		}
+		pairs = append(pairs, k+"="+v)
+	}
+	return strings.Join(pairs, " ")
+}
+
+// MarshalJSON marshals the Msg with its fields as top-level keys. Fields that would clash
+// with one of the Msg's own keys are prefixed with "field_". Fields that can't be marshaled
+// are written in their string form instead, and the errors are reported in a "log_error"
+// field, so one bad value doesn't lose the whole message
+func (m Msg) MarshalJSON() ([]byte, error) {
+	var (
+		out  = make(map[string]interface{}, len(m.Fields)+6)
+		errs []string
+	)
+	for _, k := range m.Fields.sortedKeys() {
+		v, err := fieldJSON(m.Fields[k])
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("field '%s': %v", k, err))
+		}
+		if _, ok := reservedKeys[k]; ok {
+			k = "field_" + k
+		}
+		out[k] = v
+	}
+	if len(errs) > 0 {
+		out["log_error"] = "unable to marshal " + strings.Join(errs, "; ")
+	}
+	out["time"] = m.Time
+	if m.Component != "" {
+		out["component"] = m.Component
+	}
+	out["func_name"] = m.FuncName
+	out["level"] = m.Level
+	out["message"] = m.Message
+	return json.Marshal(out)
+}
+
+// fieldJSON marshals a field's value. If the value can't be marshaled, its string form is
+// used instead, and the error is returned along with it
+func fieldJSON(v interface{}) (json.RawMessage, error) {
+	b, err := json.Marshal(fieldValue(v))
+	if err == nil {
+		return b, nil
+	}
+	b, _ = json.Marshal(fmt.Sprintf("%+v", v))
+	return b, err
+}
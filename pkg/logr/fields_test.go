@@ -0,0 +1,85 @@
+package logr
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// badMarshaler always fails to marshal
+type badMarshaler struct{ Name string }
+
+func (badMarshaler) MarshalJSON() ([]byte, error) { return nil, errors.New("no thanks") }
+
+func TestMsgMarshalJSON(t *testing.T) {
+	tests := []struct {
+		name      string
+		fields    Fields
+		want      map[string]interface{}
+		wantError string
+	}{
+		{
+			name:   "plain values",
+			fields: Fields{"user": "alice", "count": 3},
+			want:   map[string]interface{}{"user": "alice", "count": 3.0},
+		},
+		{
+			name:   "errors and durations",
+			fields: Fields{"error": errors.New("boom"), "duration": 2 * time.Second},
+			want:   map[string]interface{}{"error": "boom", "duration": "2s"},
+		},
+		{
+			name:   "reserved key",
+			fields: Fields{"message": "field value"},
+			want:   map[string]interface{}{"field_message": "field value", "message": "hello"},
+		},
+		{
+			name:      "failing marshaler",
+			fields:    Fields{"thing": badMarshaler{Name: "x"}, "user": "alice"},
+			want:      map[string]interface{}{"thing": "{Name:x}", "user": "alice"},
+			wantError: "field 'thing'",
+		},
+		{
+			name:      "unsupported type",
+			fields:    Fields{"ch": make(chan int)},
+			wantError: "field 'ch'",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			line := FormatJSON(Msg{Level: "INFO", Message: "hello", Fields: tt.fields})
+			var got map[string]interface{}
+			if err := json.Unmarshal([]byte(line), &got); err != nil {
+				t.Fatalf("FormatJSON returned invalid json %q: %v", line, err)
+			}
+			if got["message"] != "hello" {
+				t.Errorf("message = %v, want hello", got["message"])
+			}
+			for k, v := range tt.want {
+				if got[k] != v {
+					t.Errorf("%s = %v, want %v", k, got[k], v)
+				}
+			}
+			logErr, _ := got["log_error"].(string)
+			if tt.wantError == "" && logErr != "" {
+				t.Errorf("unexpected log_error %q", logErr)
+			}
+			if !strings.Contains(logErr, tt.wantError) {
+				t.Errorf("log_error = %q, want it to contain %q", logErr, tt.wantError)
+			}
+		})
+	}
+}
+
+func TestToJsonFallback(t *testing.T) {
+	line := toJson(make(chan int))
+	var got map[string]string
+	if err := json.Unmarshal([]byte(line), &got); err != nil {
+		t.Fatalf("toJson returned invalid json %q: %v", line, err)
+	}
+	if got["log_error"] == "" {
+		t.Errorf("toJson did not report the error: %q", line)
+	}
+}
@@ -0,0 +1,175 @@
+package logr
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Handler receives log messages from a Logger and writes them somewhere. Implementations
+// must be safe for concurrent use
+type Handler interface {
+	// Enabled returns true if the Handler wants messages with the given Level
+	Enabled(Level) bool
+
+	// Handle writes a message
+	Handle(Msg) error
+}
+
+// WriterHandler writes messages to an io.Writer as text or JSON
+type WriterHandler struct {
+	Writer   io.Writer
+	JSON     bool
+	MinLevel Level
+
+	mu sync.Mutex
+}
+
+// NewWriterHandler returns a new WriterHandler
+func NewWriterHandler(writer io.Writer, json bool, minLevel Level) *WriterHandler {
+	return &WriterHandler{
+		Writer:   writer,
+		JSON:     json,
+		MinLevel: minLevel,
+	}
+}
+
+// Enabled returns true if level is at least the WriterHandler's MinLevel
+func (h *WriterHandler) Enabled(level Level) bool {
+	return level.AtLeast(h.MinLevel)
+}
+
+// Handle writes a message to the Writer
+func (h *WriterHandler) Handle(m Msg) error {
+	s := FormatText(m)
+	if h.JSON {
+		s = FormatJSON(m)
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := io.WriteString(h.Writer, s)
+	return err
+}
+
+// MultiHandler sends every message to each of its Handlers that wants it
+type MultiHandler []Handler
+
+// Enabled returns true if any of the Handlers want messages with the given Level
+func (mh MultiHandler) Enabled(level Level) bool {
+	for _, h := range mh {
+		if h.Enabled(level) {
+			return true
+		}
+	}
+	return false
+}
+
+// Handle sends a message to each of the Handlers that want it. Every Handler is tried, even
+// if some of them fail
+func (mh MultiHandler) Handle(m Msg) error {
+	var (
+		level = m.LevelValue()
+		errs  = make([]string, 0)
+	)
+	for _, h := range mh {
+		if !h.Enabled(level) {
+			continue
+		}
+		if err := h.Handle(m); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%d handlers failed: %s", len(errs), strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// RingBuffer is a Handler that keeps the most recent messages in memory. This is mostly
+// useful in tests, or for showing recent logs on demand
+type RingBuffer struct {
+	MinLevel Level
+
+	mu    sync.Mutex
+	msgs  []Msg
+	start int // index of the oldest message
+	count int // number of stored messages
+}
+
+// NewRingBuffer returns a RingBuffer that keeps the last size messages
+func NewRingBuffer(size int, minLevel Level) *RingBuffer {
+	if size < 0 {
+		size = 0
+	}
+	return &RingBuffer{
+		MinLevel: minLevel,
+		msgs:     make([]Msg, size),
+	}
+}
+
+// Enabled returns true if level is at least the RingBuffer's MinLevel
+func (r *RingBuffer) Enabled(level Level) bool {
+	return level.AtLeast(r.MinLevel)
+}
+
+// Handle stores a message, overwriting the oldest message if the buffer is full
+func (r *RingBuffer) Handle(m Msg) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	size := len(r.msgs)
+	if size == 0 {
+		return nil
+	}
+	if r.count < size {
+		r.msgs[(r.start+r.count)%size] = m
+		r.count++
+		return nil
+	}
+	r.msgs[r.start] = m
+	r.start = (r.start + 1) % size
+	return nil
+}
+
+// Messages returns a copy of the stored messages, from oldest to newest
+func (r *RingBuffer) Messages() []Msg {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	msgs := make([]Msg, r.count)
+	for i := range msgs {
+		msgs[i] = r.msgs[(r.start+i)%len(r.msgs)]
+	}
+	return msgs
+}
+
+// Reset removes every stored message
+func (r *RingBuffer) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range r.msgs {
+		r.msgs[i] = Msg{}
+	}
+	r.start, r.count = 0, 0
+}
+
+// NewFileHandler opens a file for appending, creating it if needed, and returns a
+// WriterHandler that writes to it. Call Close on the returned WriterHandler when you're done
+// with it
+func NewFileHandler(path string, json bool, minLevel Level) (*WriterHandler, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open log file: %w", err)
+	}
+	return NewWriterHandler(f, json, minLevel), nil
+}
+
+// Close closes the Writer if it is an io.Closer
+func (h *WriterHandler) Close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if c, ok := h.Writer.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package logr
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRingBuffer(t *testing.T) {
+	tests := []struct {
+		name  string
+		size  int
+		add   []string
+		reset bool
+		after []string
+		want  []string
+	}{
+		{"empty", 3, nil, false, nil, []string{}},
+		{"not full", 3, []string{"a", "b"}, false, nil, []string{"a", "b"}},
+		{"full", 3, []string{"a", "b", "c"}, false, nil, []string{"a", "b", "c"}},
+		{"wrapped", 3, []string{"a", "b", "c", "d", "e"}, false, nil, []string{"c", "d", "e"}},
+		{"wrapped twice", 2, []string{"a", "b", "c", "d", "e"}, false, nil, []string{"d", "e"}},
+		{"zero size", 0, []string{"a"}, false, nil, []string{}},
+		{"negative size", -1, []string{"a"}, false, nil, []string{}},
+		{"reset", 3, []string{"a", "b", "c", "d"}, true, []string{"x"}, []string{"x"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRingBuffer(tt.size, LevelUnknown)
+			for _, s := range tt.add {
+				r.Handle(Msg{Message: s})
+			}
+			if tt.reset {
+				r.Reset()
+			}
+			for _, s := range tt.after {
+				r.Handle(Msg{Message: s})
+			}
+			got := make([]string, 0)
+			for _, m := range r.Messages() {
+				got = append(got, m.Message)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Messages = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
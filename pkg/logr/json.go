@@ -1,15 +1,35 @@
 package logr
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"fmt"
+)
 
-// toJson marshals an object into a json string
+// toJson marshals an object into a json string. If the object can't be marshaled, a json
+// object holding its string form and the error is returned instead
 func toJson(b interface{}) string {
-	s, _ := json.Marshal(b)
+	s, err := json.Marshal(b)
+	if err != nil {
+		return jsonFallback(b, err)
+	}
 	return string(s)
 }
 
 // toJson marshals an object into a json string with indenting
 func toJsonPretty(b interface{}) string {
-	s, _ := json.MarshalIndent(b, "", "  ")
+	s, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return jsonFallback(b, err)
+	}
+	return string(s)
+}
+
+// jsonFallback returns a json object holding the string form of an object that couldn't be
+// marshaled, and the error that stopped it
+func jsonFallback(b interface{}, err error) string {
+	s, _ := json.Marshal(map[string]string{
+		"log_error": fmt.Sprintf("unable to marshal %T: %v", b, err),
+		"message":   fmt.Sprintf("%+v", b),
+	})
 	return string(s)
 }
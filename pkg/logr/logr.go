@@ -7,6 +7,9 @@ import (
 	"time"
 )
 
+// timeFormat is the format of the time in text log messages
+const timeFormat = "02Jan2006 15:04:05"
+
 // getFrame and getCaller taken from https://stackoverflow.com/questions/35212985/is-it-possible-get-information-about-caller-function-in-golang
 func getFrame(skipFrames int) runtime.Frame {
 	// We need the frame at index skipFrames+2, since we never want runtime.Callers and getFrame
@@ -41,48 +44,156 @@ func (m Msg) String() string {
 	return fmt.Sprint(toJson(m) + "\n")
 }
 
-// Write writes the log string to the Logger.Writer with the given name string, and Level, and returns a string with the same output in case you want to do something else with it
+// LevelValue returns the Msg's Level
+func (m Msg) LevelValue() Level {
+	level, _ := ParseLevel(m.Level)
+	return level
+}
+
+// FormatText formats a Msg as a single line of text, ending in a newline
+func FormatText(m Msg) string {
+	name := m.FuncName
+	if m.Component != "" {
+		name = m.Component + "][" + name
+	}
+	var fields string
+	if len(m.Fields) > 0 {
+		fields = " " + m.Fields.String()
+	}
+	ts := strings.ToUpper(time.Unix(m.Time, 0).UTC().Format(timeFormat))
+	return fmt.Sprintf("[%v][%s] %v: %s%s\n", ts, name, m.Level, m.Message, fields)
+}
+
+// FormatJSON formats a Msg as a single line of JSON, ending in a newline
+func FormatJSON(m Msg) string {
+	return toJson(m) + "\n"
+}
+
+// Write writes the log string to the Logger.Handler, or to the Logger.Writer if there is no
+// Handler, with the given name string, and Level, and returns a string with the same output
+// in case you want to do something else with it
 func (l *Logger) Write(name string, level Level, s string, a ...interface{}) Msg {
-	var msg Msg
-	var (
-		now        = time.Now().UTC()
-		timeFormat = "02Jan2006 15:04:05"
-	)
+	msg := Msg{
+		Time:      time.Now().UTC().Unix(),
+		Component: l.Component,
+		FuncName:  name,
+		Level:     level.String(),
+		Message:   fmt.Sprintf(s, a...),
+	}
+	if len(l.fields) > 0 {
+		msg.Fields = l.Fields()
+	}
+	if l.Redactor != nil {
+		msg = l.Redactor.Redact(msg)
+	}
 
-	msg = Msg{
-		Time:     now.Unix(),
-		FuncName: name,
-		Level:    level.String(),
-		Message:  fmt.Sprintf(s, a...),
+	if l.Handler != nil {
+		if l.Handler.Enabled(level) {
+			l.Handler.Handle(msg)
+		}
+		return msg
 	}
 
+	if l.mu != nil {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+	}
 	if l.JSON {
 		// As of now, this is the same thing as calling `msg.String()`, but it's very possible
 		// the format of the stringer could change in the future, and this needs to always return
 		// json, so I've explicitly chosen not to call `msg.String()` here
-		fmt.Fprint(l.Writer, toJson(msg)+"\n")
+		fmt.Fprint(l.Writer, FormatJSON(msg))
 		return msg
 	}
-
-	a = append([]interface{}{strings.ToUpper(now.Format(timeFormat)), name, level}, a...)
-	fmt.Fprint(l.Writer, fmt.Sprintf("[%v][%s] %v: "+s+"\n", a...))
+	fmt.Fprint(l.Writer, FormatText(msg))
 	return msg
 }
 
+// WithComponent returns a copy of the Logger for the named component. The copy shares its
+// per-component level overrides with the original
+func (l *Logger) WithComponent(component string) *Logger {
+	c := *l
+	c.Component = component
+	return &c
+}
+
+// SetLevel changes the lowest Level that will be written for a single component. This
+// affects every Logger that was derived from the same Logger with WithComponent. Set the
+// level to LevelUnknown to remove the override
+func (l *Logger) SetLevel(component string, level Level) {
+	if l.levels == nil {
+		l.levels = &componentLevels{levels: make(map[string]Level)}
+	}
+	l.levels.mu.Lock()
+	defer l.levels.mu.Unlock()
+	if level == LevelUnknown {
+		delete(l.levels.levels, component)
+		return
+	}
+	l.levels.levels[component] = level
+}
+
+// minLevel returns the lowest Level that will be written by this Logger
+func (l *Logger) minLevel() Level {
+	if l.levels != nil && l.Component != "" {
+		l.levels.mu.RLock()
+		level, ok := l.levels.levels[l.Component]
+		l.levels.mu.RUnlock()
+		if ok {
+			return level
+		}
+	}
+
+	switch {
+	case l.MinLevel != LevelUnknown:
+		return l.MinLevel
+	case l.EnableDebug:
+		return LevelDebug
+	}
+	return LevelInfo
+}
+
+// Enabled returns true if messages with the given Level will be written
+func (l *Logger) Enabled(level Level) bool {
+	return level.AtLeast(l.minLevel())
+}
+
 // Error sets the Level to LevelError, and automatically sets the name of the caller, then calls Write
 func (l *Logger) Error(s string, a ...interface{}) Msg {
+	if !l.Enabled(LevelError) {
+		return Msg{}
+	}
 	return l.Write(getCaller(), LevelError, s, a...)
 }
 
+// Warn sets the Level to LevelWarn, and automatically sets the name of the caller, then calls Write
+func (l *Logger) Warn(s string, a ...interface{}) Msg {
+	if !l.Enabled(LevelWarn) {
+		return Msg{}
+	}
+	return l.Write(getCaller(), LevelWarn, s, a...)
+}
+
 // Info sets the Level to LevelInfo, and automatically sets the name of the caller, then calls Write
 func (l *Logger) Info(s string, a ...interface{}) Msg {
+	if !l.Enabled(LevelInfo) {
+		return Msg{}
+	}
 	return l.Write(getCaller(), LevelInfo, s, a...)
 }
 
-// Debug sets the Level to LevelDebug, and automatically sets the name of the caller, then calls Write only if Logger.EnableDebug is true
+// Debug sets the Level to LevelDebug, and automatically sets the name of the caller, then calls Write only if debug messages are enabled
 func (l *Logger) Debug(s string, a ...interface{}) Msg {
-	if !l.EnableDebug {
+	if !l.Enabled(LevelDebug) {
 		return Msg{}
 	}
 	return l.Write(getCaller(), LevelDebug, s, a...)
 }
+
+// Trace sets the Level to LevelTrace, and automatically sets the name of the caller, then calls Write only if trace messages are enabled
+func (l *Logger) Trace(s string, a ...interface{}) Msg {
+	if !l.Enabled(LevelTrace) {
+		return Msg{}
+	}
+	return l.Write(getCaller(), LevelTrace, s, a...)
+}
@@ -0,0 +1,265 @@
+package logr
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// DefaultRedactReplacement replaces redacted text when a rule doesn't have its own
+// replacement
+const DefaultRedactReplacement = "[REDACTED]"
+
+// RedactRule replaces every match of Pattern in log messages with Replacement. Replacement
+// can refer to submatches like regexp.Regexp.ReplaceAllString
+type RedactRule struct {
+	Name        string
+	Pattern     *regexp.Regexp
+	Replacement string
+}
+
+// Redactor removes sensitive values from log messages before they're written anywhere. It
+// applies regex rules and registered secrets to the message text and to string fields, and
+// replaces the values of chosen fields, like usernames and conversation IDs, with a salted
+// hash so they can still be correlated without being readable. Redactor is safe for
+// concurrent use
+type Redactor struct {
+	mu      sync.RWMutex
+	rules   []RedactRule
+	secrets []string
+	hashed  map[string]bool
+	salt    []byte
+}
+
+// NewRedactor returns a Redactor with no rules. The salt used for hashing is random, so
+// hashes only match within a single run of the program unless SetSalt is called
+func NewRedactor() *Redactor {
+	salt := make([]byte, 16)
+	rand.Read(salt)
+	return &Redactor{
+		rules:   make([]RedactRule, 0),
+		secrets: make([]string, 0),
+		hashed:  make(map[string]bool),
+		salt:    salt,
+	}
+}
+
+// AddRule adds a rule that replaces every match of pattern with DefaultRedactReplacement
+func (r *Redactor) AddRule(name, pattern string) error {
+	return r.AddRuleReplacement(name, pattern, DefaultRedactReplacement)
+}
+
+// AddRuleReplacement adds a rule that replaces every match of pattern with replacement
+func (r *Redactor) AddRuleReplacement(name, pattern, replacement string) error {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return fmt.Errorf("invalid redaction rule %s: %w", name, err)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.rules = append(r.rules, RedactRule{Name: name, Pattern: re, Replacement: replacement})
+	return nil
+}
+
+// AddSecret registers values, like API tokens read from a config file, that should never
+// show up in the logs. Empty values are ignored
+func (r *Redactor) AddSecret(values ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, v := range values {
+		if v != "" {
+			r.secrets = append(r.secrets, v)
+		}
+	}
+
+	// replace longer secrets first, so a secret that contains another one is removed whole
+	sort.Slice(r.secrets, func(i, j int) bool {
+		return len(r.secrets[i]) > len(r.secrets[j])
+	})
+}
+
+// HashFields causes the values of the fields with the given keys to be replaced with a
+// salted hash, both in the fields and anywhere the values appear in the message text
+func (r *Redactor) HashFields(keys ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, k := range keys {
+		r.hashed[k] = true
+	}
+}
+
+// SetSalt sets the salt used for hashing field values. Use the same salt every time the
+// program runs if you need hashes to match across restarts
+func (r *Redactor) SetSalt(salt []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.salt = append([]byte(nil), salt...)
+}
+
+// Hash returns the salted hash that a field value is replaced with
+func (r *Redactor) Hash(v interface{}) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.hash(v)
+}
+
+// hash returns the salted hash of a value. It must be called with the lock held
+func (r *Redactor) hash(v interface{}) string {
+	h := sha256.New()
+	h.Write(r.salt)
+	fmt.Fprint(h, v)
+	return "h:" + hex.EncodeToString(h.Sum(nil))[:12]
+}
+
+// String removes secrets and rule matches from a string
+func (r *Redactor) String(s string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.redact(s)
+}
+
+// redact removes secrets and rule matches from a string. It must be called with the lock
+// held
+func (r *Redactor) redact(s string) string {
+	for _, secret := range r.secrets {
+		s = strings.ReplaceAll(s, secret, DefaultRedactReplacement)
+	}
+	for _, rule := range r.rules {
+		s = rule.Pattern.ReplaceAllString(s, rule.Replacement)
+	}
+	return s
+}
+
+// Redact returns a copy of a message with sensitive values removed. Fields that aren't
+// strings are converted to strings first if there are any secrets or rules that could match
+// them
+func (r *Redactor) Redact(m Msg) Msg {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	// values of hashed fields are also hashed wherever they show up in the message text as a
+	// whole word, so a message like "Incoming message from alice" doesn't give away the
+	// sender, but "alice" isn't hashed inside "malice". Longer values go first, so a channel
+	// like "alice,bob" is hashed before "alice" is
+	values := make([]string, 0)
+	hashes := make(map[string]string)
+	for k, v := range m.Fields {
+		if !r.hashed[k] {
+			continue
+		}
+		if value := fmt.Sprint(fieldValue(v)); value != "" {
+			values = append(values, value)
+			hashes[value] = r.hash(v)
+		}
+	}
+	sort.Slice(values, func(i, j int) bool {
+		return len(values[i]) > len(values[j])
+	})
+	for _, value := range values {
+		m.Message = replaceTokens(m.Message, value, hashes[value])
+	}
+	m.Message = r.redact(m.Message)
+	if len(m.Fields) == 0 {
+		return m
+	}
+
+	var (
+		fields   = make(Fields, len(m.Fields))
+		hasRules = len(r.secrets) > 0 || len(r.rules) > 0
+	)
+	for k, v := range m.Fields {
+		switch {
+		case r.hashed[k]:
+			fields[k] = r.hash(v)
+		case !hasRules:
+			fields[k] = v
+		default:
+			switch value := fieldValue(v).(type) {
+			case string:
+				fields[k] = r.redact(value)
+			case bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+				fields[k] = value
+			default:
+				fields[k] = r.redact(fmt.Sprint(value))
+			}
+		}
+	}
+	m.Fields = fields
+	return m
+}
+
+// replaceTokens replaces every occurrence of old in s that is a whole word, and not part of
+// a longer word, with new. Letters, digits, and underscores are part of a word, and so are
+// dots and dashes between two of those, like in "team.subteam"
+func replaceTokens(s, old, new string) string {
+	if old == "" {
+		return s
+	}
+	var (
+		out   strings.Builder
+		start int
+	)
+	for {
+		i := strings.Index(s[start:], old)
+		if i < 0 {
+			break
+		}
+		i += start
+		end := i + len(old)
+		if tokenStart(s, i) && tokenEnd(s, end) {
+			out.WriteString(s[start:i])
+			out.WriteString(new)
+			start = end
+			continue
+		}
+		_, size := utf8.DecodeRuneInString(s[i:])
+		out.WriteString(s[start : i+size])
+		start = i + size
+	}
+	out.WriteString(s[start:])
+	return out.String()
+}
+
+// wordRune returns true if r is part of a word
+func wordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+// tokenStart returns true if a word can start at index i of s
+func tokenStart(s string, i int) bool {
+	if i == 0 {
+		return true
+	}
+	r, size := utf8.DecodeLastRuneInString(s[:i])
+	if wordRune(r) {
+		return false
+	}
+	if r == '.' || r == '-' {
+		before, _ := utf8.DecodeLastRuneInString(s[:i-size])
+		return i-size == 0 || !wordRune(before)
+	}
+	return true
+}
+
+// tokenEnd returns true if a word can end at index i of s
+func tokenEnd(s string, i int) bool {
+	if i == len(s) {
+		return true
+	}
+	r, size := utf8.DecodeRuneInString(s[i:])
+	if wordRune(r) {
+		return false
+	}
+	if r == '.' || r == '-' {
+		after, _ := utf8.DecodeRuneInString(s[i+size:])
+		return i+size == len(s) || !wordRune(after)
+	}
+	return true
+}
@@ -0,0 +1,98 @@
+package logr
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReplaceTokens(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		old  string
+		want string
+	}{
+		{"whole word", "message from alice", "alice", "message from X"},
+		{"inside a word", "malice and alice", "alice", "malice and X"},
+		{"prefix of a word", "alice2 and alice", "alice", "alice2 and X"},
+		{"underscore", "alice_bot alice", "alice", "alice_bot X"},
+		{"end of sentence", "sent by alice.", "alice", "sent by X."},
+		{"team name", "team.sub and team", "team", "team.sub and X"},
+		{"dashed word", "alice-bot and alice", "alice", "alice-bot and X"},
+		{"quoted", "user 'alice' said", "alice", "user 'X' said"},
+		{"channel", "in alice,bob now", "alice,bob", "in X now"},
+		{"unicode neighbour", "éalice alice", "alice", "éalice X"},
+		{"repeated", "alice alice", "alice", "X X"},
+		{"no match", "bob", "alice", "bob"},
+		{"empty", "alice", "", "alice"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := replaceTokens(tt.s, tt.old, "X"); got != tt.want {
+				t.Errorf("replaceTokens(%q, %q) = %q, want %q", tt.s, tt.old, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedactorRedact(t *testing.T) {
+	r := NewRedactor()
+	r.SetSalt([]byte("salt"))
+	r.HashFields("sender", "channel")
+	r.AddSecret("hunter2")
+	if err := r.AddRule("token", `tok_[a-z0-9]+`); err != nil {
+		t.Fatal(err)
+	}
+	var (
+		alice   = r.Hash("alice")
+		channel = r.Hash("alice,bob")
+	)
+
+	tests := []struct {
+		name       string
+		msg        Msg
+		wantMsg    string
+		wantFields Fields
+	}{
+		{
+			name:       "hashed field in message",
+			msg:        Msg{Message: "Incoming message from alice", Fields: Fields{"sender": "alice"}},
+			wantMsg:    "Incoming message from " + alice,
+			wantFields: Fields{"sender": alice},
+		},
+		{
+			name:       "hashed field inside another word",
+			msg:        Msg{Message: "malice from alice", Fields: Fields{"sender": "alice"}},
+			wantMsg:    "malice from " + alice,
+			wantFields: Fields{"sender": alice},
+		},
+		{
+			name:       "longer values first",
+			msg:        Msg{Message: "alice in alice,bob", Fields: Fields{"sender": "alice", "channel": "alice,bob"}},
+			wantMsg:    alice + " in " + channel,
+			wantFields: Fields{"sender": alice, "channel": channel},
+		},
+		{
+			name:       "secrets and rules",
+			msg:        Msg{Message: "password hunter2 token tok_abc123", Fields: Fields{"note": "hunter2", "count": 3}},
+			wantMsg:    "password [REDACTED] token [REDACTED]",
+			wantFields: Fields{"note": "[REDACTED]", "count": 3},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := r.Redact(tt.msg)
+			if got.Message != tt.wantMsg {
+				t.Errorf("Message = %q, want %q", got.Message, tt.wantMsg)
+			}
+			for k, v := range tt.wantFields {
+				if got.Fields[k] != v {
+					t.Errorf("field %s = %v, want %v", k, got.Fields[k], v)
+				}
+			}
+			if strings.Contains(got.String(), "hunter2") {
+				t.Errorf("secret leaked: %s", got.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,282 @@
+package logr
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// backupTimeFormat is the format of the timestamp added to the names of rotated files. It
+// sorts in the same order as the times it represents
+const backupTimeFormat = "20060102T150405.000"
+
+// RotatingWriter is an io.Writer that writes to a file, and moves the file aside and starts
+// a new one when it gets too big or too old. Rotated files are compressed with gzip (or left
+// as they are if that fails), and only the newest MaxBackups are kept. RotatingWriter is
+// safe for concurrent use
+type RotatingWriter struct {
+	// The file to write to. Rotated files are put next to it, with a timestamp and a .gz
+	// extension added to the name
+	Filename string
+
+	// Rotate when the file would grow past this many bytes. Zero means no size limit
+	MaxSize int64
+
+	// Rotate when the file is this old. Zero means no age limit. A file that already has
+	// something in it when it's opened is as old as its modification time, since that's the
+	// closest thing to its creation time every platform has
+	MaxAge time.Duration
+
+	// How many rotated files to keep. Zero means keep them all
+	MaxBackups int
+
+	mu         sync.Mutex
+	file       *os.File
+	size       int64
+	openedAt   time.Time
+	lastRotate time.Time
+	compress   sync.WaitGroup
+}
+
+// NewRotatingWriter opens filename for appending, creating it if needed, and returns a
+// RotatingWriter that writes to it
+func NewRotatingWriter(filename string, maxSize int64, maxAge time.Duration, maxBackups int) (*RotatingWriter, error) {
+	w := &RotatingWriter{
+		Filename:   filename,
+		MaxSize:    maxSize,
+		MaxAge:     maxAge,
+		MaxBackups: maxBackups,
+	}
+	if err := w.open(nil); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// open opens the file for appending. If prev describes the same file, the file keeps its
+// age. It must be called with the lock held
+func (w *RotatingWriter) open(prev os.FileInfo) error {
+	f, err := os.OpenFile(w.Filename, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("unable to open log file: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("unable to stat log file: %w", err)
+	}
+	w.file = f
+	w.size = info.Size()
+	switch {
+	case prev != nil && os.SameFile(prev, info):
+	case info.Size() > 0:
+		w.openedAt = info.ModTime()
+	default:
+		w.openedAt = time.Now()
+	}
+	return nil
+}
+
+// Write writes p to the file, rotating it first if writing p would go past MaxSize, or if
+// the file is older than MaxAge
+func (w *RotatingWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		if err := w.open(nil); err != nil {
+			return 0, err
+		}
+	}
+
+	var (
+		tooBig = w.MaxSize > 0 && w.size > 0 && w.size+int64(len(p)) > w.MaxSize
+		tooOld = w.MaxAge > 0 && time.Since(w.openedAt) >= w.MaxAge
+	)
+	if tooBig || tooOld {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// Rotate moves the current file aside and starts a new one, whether or not it's big or old
+// enough to be rotated
+func (w *RotatingWriter) Rotate() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.rotate()
+}
+
+// rotate moves the current file aside, opens a new one, and compresses the old one in the
+// background. It must be called with the lock held
+func (w *RotatingWriter) rotate() error {
+	if w.file != nil {
+		if err := w.file.Close(); err != nil {
+			return fmt.Errorf("unable to close log file: %w", err)
+		}
+		w.file = nil
+	}
+
+	// backups are named after the time they were rotated, so make sure two rotations in the
+	// same millisecond don't get the same name
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	if !now.After(w.lastRotate) {
+		now = w.lastRotate.Add(time.Millisecond)
+	}
+	w.lastRotate = now
+	backup := w.Filename + "." + now.Format(backupTimeFormat)
+	if err := os.Rename(w.Filename, backup); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("unable to rotate log file: %w", err)
+	}
+	if err := w.open(nil); err != nil {
+		return err
+	}
+
+	w.compress.Add(1)
+	go func() {
+		defer w.compress.Done()
+		if err := compressFile(backup); err != nil {
+			fmt.Fprintf(os.Stderr, "logr: %v\n", err)
+		}
+		w.prune()
+	}()
+	return nil
+}
+
+// Reopen closes and reopens the file without rotating it. Use this after something else,
+// like logrotate, has moved the file. If the file hasn't been moved, it keeps its age
+func (w *RotatingWriter) Reopen() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var prev os.FileInfo
+	if w.file != nil {
+		prev, _ = w.file.Stat()
+		w.file.Close()
+		w.file = nil
+	}
+	return w.open(prev)
+}
+
+// ReopenOnSignal calls Reopen whenever the process receives one of the given signals. If no
+// signals are given, SIGHUP is used on platforms that have it. Call the returned function
+// to stop listening for the signals
+func (w *RotatingWriter) ReopenOnSignal(sigs ...os.Signal) (stop func()) {
+	if len(sigs) == 0 {
+		sigs = reopenSignals
+	}
+	if len(sigs) == 0 {
+		return func() {}
+	}
+
+	c := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(c, sigs...)
+	go func() {
+		for {
+			select {
+			case <-c:
+				if err := w.Reopen(); err != nil {
+					fmt.Fprintf(os.Stderr, "logr: %v\n", err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(c)
+			close(done)
+		})
+	}
+}
+
+// Close closes the file, and waits for any rotated files to finish being compressed
+func (w *RotatingWriter) Close() error {
+	w.mu.Lock()
+	var err error
+	if w.file != nil {
+		err = w.file.Close()
+		w.file = nil
+	}
+	w.mu.Unlock()
+	w.compress.Wait()
+	return err
+}
+
+// prune removes the oldest rotated files, leaving MaxBackups of them. Files that couldn't
+// be compressed are counted too, and a file that is still being compressed is counted once
+func (w *RotatingWriter) prune() {
+	if w.MaxBackups <= 0 {
+		return
+	}
+	matches, err := filepath.Glob(w.Filename + ".*")
+	if err != nil {
+		return
+	}
+	backups := make(map[string][]string)
+	for _, match := range matches {
+		stamp := strings.TrimSuffix(strings.TrimPrefix(match, w.Filename+"."), ".gz")
+		if _, err := time.Parse(backupTimeFormat, stamp); err == nil {
+			backups[stamp] = append(backups[stamp], match)
+		}
+	}
+	if len(backups) <= w.MaxBackups {
+		return
+	}
+	stamps := make([]string, 0, len(backups))
+	for stamp := range backups {
+		stamps = append(stamps, stamp)
+	}
+	sort.Strings(stamps)
+	for _, stamp := range stamps[:len(stamps)-w.MaxBackups] {
+		for _, backup := range backups[stamp] {
+			os.Remove(backup)
+		}
+	}
+}
+
+// compressFile gzips a file, and removes the original
+func compressFile(name string) error {
+	in, err := os.Open(name)
+	if err != nil {
+		return fmt.Errorf("unable to open rotated log file: %w", err)
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(name+".gz", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("unable to create compressed log file: %w", err)
+	}
+	gz := gzip.NewWriter(out)
+	if _, err := io.Copy(gz, in); err != nil {
+		gz.Close()
+		out.Close()
+		os.Remove(name + ".gz")
+		return fmt.Errorf("unable to compress rotated log file: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		out.Close()
+		os.Remove(name + ".gz")
+		return fmt.Errorf("unable to compress rotated log file: %w", err)
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("unable to compress rotated log file: %w", err)
+	}
+	in.Close()
+	return os.Remove(name)
+}
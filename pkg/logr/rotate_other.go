@@ -0,0 +1,10 @@
+//go:build windows || plan9
+// +build windows plan9
+
+package logr
+
+import "os"
+
+// reopenSignals are the signals RotatingWriter.ReopenOnSignal listens for by default. There
+// is no SIGHUP on this platform
+var reopenSignals []os.Signal
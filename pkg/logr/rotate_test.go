@@ -0,0 +1,192 @@
+package logr
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+// tempLog returns the path of a log file in a new temporary directory
+func tempLog(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "logr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return filepath.Join(dir, "bot.log")
+}
+
+// backups returns the names of the rotated files next to a log file
+func backups(t *testing.T, name string) []string {
+	matches, err := filepath.Glob(name + ".*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range matches {
+		matches[i] = filepath.Base(matches[i])
+	}
+	sort.Strings(matches)
+	return matches
+}
+
+func TestRotatingWriterSize(t *testing.T) {
+	name := tempLog(t)
+	w, err := NewRotatingWriter(name, 10, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"12345678\n", "abcdefgh\n", "ABCDEFGH\n"} {
+		if _, err := w.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w.Close()
+
+	if got := backups(t, name); len(got) != 2 {
+		t.Errorf("backups = %v, want 2", got)
+	}
+	data, _ := ioutil.ReadFile(name)
+	if string(data) != "ABCDEFGH\n" {
+		t.Errorf("current file = %q, want the last line", data)
+	}
+}
+
+func TestRotatingWriterPrune(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing []string
+		keep     int
+		want     []string
+	}{
+		{
+			name:     "compressed",
+			existing: []string{"20200101T000000.000.gz", "20200102T000000.000.gz", "20200103T000000.000.gz"},
+			keep:     2,
+			want:     []string{"20200102T000000.000.gz", "20200103T000000.000.gz"},
+		},
+		{
+			name:     "raw",
+			existing: []string{"20200101T000000.000", "20200102T000000.000", "20200103T000000.000.gz"},
+			keep:     1,
+			want:     []string{"20200103T000000.000.gz"},
+		},
+		{
+			name:     "being compressed",
+			existing: []string{"20200101T000000.000", "20200101T000000.000.gz", "20200102T000000.000.gz"},
+			keep:     2,
+			want:     []string{"20200101T000000.000", "20200101T000000.000.gz", "20200102T000000.000.gz"},
+		},
+		{
+			name:     "other files",
+			existing: []string{"old", "20200101T000000.000.gz", "20200102T000000.000.gz"},
+			keep:     1,
+			want:     []string{"20200102T000000.000.gz", "old"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name := tempLog(t)
+			for _, suffix := range tt.existing {
+				if err := ioutil.WriteFile(name+"."+suffix, []byte("x"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			w := &RotatingWriter{Filename: name, MaxBackups: tt.keep}
+			w.prune()
+
+			want := make([]string, len(tt.want))
+			for i, suffix := range tt.want {
+				want[i] = "bot.log." + suffix
+			}
+			got := backups(t, name)
+			if len(got) != len(want) {
+				t.Fatalf("backups = %v, want %v", got, want)
+			}
+			for i := range got {
+				if got[i] != want[i] {
+					t.Errorf("backups = %v, want %v", got, want)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestRotatingWriterAge(t *testing.T) {
+	tests := []struct {
+		name       string
+		modified   time.Duration
+		reopen     bool
+		wantRotate bool
+	}{
+		{"fresh file", 0, false, false},
+		{"old file", -2 * time.Hour, false, true},
+		{"old file after reopen", -2 * time.Hour, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name := tempLog(t)
+			if err := ioutil.WriteFile(name, []byte("existing\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			modified := time.Now().Add(tt.modified)
+			if err := os.Chtimes(name, modified, modified); err != nil {
+				t.Fatal(err)
+			}
+
+			w, err := NewRotatingWriter(name, 0, time.Hour, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.reopen {
+				if err := w.Reopen(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			w.Write([]byte("new\n"))
+			w.Close()
+
+			if rotated := len(backups(t, name)) > 0; rotated != tt.wantRotate {
+				t.Errorf("rotated = %v, want %v", rotated, tt.wantRotate)
+			}
+		})
+	}
+}
+
+func TestRotatingWriterReopen(t *testing.T) {
+	tests := []struct {
+		name    string
+		moved   bool
+		wantOld bool
+	}{
+		{"same file keeps its age", false, true},
+		{"moved file starts over", true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name := tempLog(t)
+			w, err := NewRotatingWriter(name, 0, time.Hour, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer w.Close()
+			w.Write([]byte("line\n"))
+			old := time.Now().Add(-30 * time.Minute)
+			w.openedAt = old
+			if tt.moved {
+				if err := os.Rename(name, name+".moved"); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := w.Reopen(); err != nil {
+				t.Fatal(err)
+			}
+			if got := w.openedAt.Equal(old); got != tt.wantOld {
+				t.Errorf("kept age = %v, want %v", got, tt.wantOld)
+			}
+		})
+	}
+}
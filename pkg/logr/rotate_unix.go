@@ -0,0 +1,12 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package logr
+
+import (
+	"os"
+	"syscall"
+)
+
+// reopenSignals are the signals RotatingWriter.ReopenOnSignal listens for by default
+var reopenSignals = []os.Signal{syscall.SIGHUP}
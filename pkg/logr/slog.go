@@ -0,0 +1,144 @@
+//go:build go1.21
+// +build go1.21
+
+// The slog adapters use the log/slog package, which was added in Go 1.21. The module still
+// supports Go 1.15 (see go.mod), so this file is only built with Go 1.21 or newer, and
+// SlogSink, NewSlogHandler, and LevelTraceSlog don't exist when building with an older Go
+
+package logr
+
+import (
+	"context"
+	"log/slog"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// LevelTraceSlog is the slog.Level that LevelTrace is mapped to
+const LevelTraceSlog = slog.Level(-8)
+
+// toSlogLevel converts a Level to a slog.Level
+func toSlogLevel(level Level) slog.Level {
+	switch level {
+	case LevelTrace:
+		return LevelTraceSlog
+	case LevelDebug:
+		return slog.LevelDebug
+	case LevelWarn:
+		return slog.LevelWarn
+	case LevelError:
+		return slog.LevelError
+	}
+	return slog.LevelInfo
+}
+
+// fromSlogLevel converts a slog.Level to a Level
+func fromSlogLevel(level slog.Level) Level {
+	switch {
+	case level >= slog.LevelError:
+		return LevelError
+	case level >= slog.LevelWarn:
+		return LevelWarn
+	case level >= slog.LevelInfo:
+		return LevelInfo
+	case level >= slog.LevelDebug:
+		return LevelDebug
+	}
+	return LevelTrace
+}
+
+// slogSink is a Handler that sends messages to a slog.Handler
+type slogSink struct {
+	h slog.Handler
+}
+
+// SlogSink returns a Handler that sends messages to a slog.Handler. Fields, the component,
+// and the function name are sent as attributes. It requires Go 1.21 or newer
+func SlogSink(h slog.Handler) Handler {
+	return slogSink{h: h}
+}
+
+// Enabled returns true if the slog.Handler wants messages with the given Level
+func (s slogSink) Enabled(level Level) bool {
+	return s.h.Enabled(context.Background(), toSlogLevel(level))
+}
+
+// Handle sends a message to the slog.Handler
+func (s slogSink) Handle(m Msg) error {
+	r := slog.NewRecord(time.Unix(m.Time, 0), toSlogLevel(m.LevelValue()), m.Message, 0)
+	if m.Component != "" {
+		r.AddAttrs(slog.String("component", m.Component))
+	}
+	r.AddAttrs(slog.String("func_name", m.FuncName))
+	for _, k := range m.Fields.sortedKeys() {
+		r.AddAttrs(slog.Any(k, fieldValue(m.Fields[k])))
+	}
+	return s.h.Handle(context.Background(), r)
+}
+
+// slogHandler is a slog.Handler that writes to a Logger
+type slogHandler struct {
+	l     *Logger
+	group string
+}
+
+// NewSlogHandler returns a slog.Handler that writes to a Logger, so packages that log with
+// slog end up in the same place as everything else. Attributes become fields, with group
+// names joined to attribute keys with a ".". It requires Go 1.21 or newer
+func NewSlogHandler(l *Logger) slog.Handler {
+	return slogHandler{l: l}
+}
+
+// Enabled returns true if the Logger will write messages with the given level
+func (h slogHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return h.l.Enabled(fromSlogLevel(level))
+}
+
+// key returns an attribute key with the handler's group prefix
+func (h slogHandler) key(k string) string {
+	if h.group == "" {
+		return k
+	}
+	return h.group + "." + k
+}
+
+// Handle writes a slog.Record to the Logger
+func (h slogHandler) Handle(_ context.Context, r slog.Record) error {
+	fields := Fields{}
+	r.Attrs(func(a slog.Attr) bool {
+		fields[h.key(a.Key)] = a.Value.Resolve().Any()
+		return true
+	})
+
+	name := "unknown"
+	if r.PC != 0 {
+		frame, _ := runtime.CallersFrames([]uintptr{r.PC}).Next()
+		parts := strings.Split(frame.Function, ".")
+		name = parts[len(parts)-1]
+	}
+
+	l := h.l
+	if len(fields) > 0 {
+		l = l.WithFields(fields)
+	}
+	l.Write(name, fromSlogLevel(r.Level), "%s", r.Message)
+	return nil
+}
+
+// WithAttrs returns a slog.Handler that attaches the given attributes to every message
+func (h slogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	fields := Fields{}
+	for _, a := range attrs {
+		fields[h.key(a.Key)] = a.Value.Resolve().Any()
+	}
+	return slogHandler{l: h.l.WithFields(fields), group: h.group}
+}
+
+// WithGroup returns a slog.Handler that prefixes attribute keys with the group name
+func (h slogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return slogHandler{l: h.l, group: h.key(name)}
+}
@@ -1,12 +1,51 @@
 package logr
 
-import "io"
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
 
 // Logger holds information necessary to write log output
 type Logger struct {
 	Writer      io.Writer // Where to write log messages
 	EnableDebug bool      // Whether to write debug messages
 	JSON        bool      // Whether to write messages in JSON format
+
+	// Handler receives every message that passes the Logger's level checks. If Handler is
+	// set, Writer and JSON are ignored. Use MultiHandler to send messages to more than one
+	// place
+	Handler Handler
+
+	// Redactor removes sensitive values from every message before it's written to the
+	// Handler or the Writer
+	Redactor *Redactor
+
+	// MinLevel is the lowest Level that will be written. If this is LevelUnknown, LevelInfo
+	// is used, or LevelDebug if EnableDebug is true
+	MinLevel Level
+
+	// Component is the name of the part of the program this Logger belongs to. Use
+	// WithComponent to create a Logger for a component, and SetLevel to change the MinLevel
+	// for a single component
+	Component string
+
+	// fields are attached to every message this Logger writes
+	fields Fields
+
+	// levels holds the per-component level overrides, and is shared with every Logger
+	// derived from this one
+	levels *componentLevels
+
+	// mu serializes writes to Writer, and is shared with every Logger derived from this one
+	mu *sync.Mutex
+}
+
+// componentLevels holds per-component level overrides
+type componentLevels struct {
+	mu     sync.RWMutex
+	levels map[string]Level
 }
 
 // New returns a new Logger
@@ -15,25 +54,42 @@ func New(writer io.Writer, debug, json bool) *Logger {
 		Writer:      writer,
 		EnableDebug: debug,
 		JSON:        json,
+		levels:      &componentLevels{levels: make(map[string]Level)},
+		mu:          &sync.Mutex{},
 	}
 }
 
 // Level represents a LogLevel (Info, Error, Debug, etc)
 type Level int
 
-// These constants represent the various known Levels
+// These constants represent the various known Levels. Their values are kept stable, so
+// newer Levels are added at the end; use AtLeast to compare how severe two Levels are
 const (
-	LevelUnknown Level = iota
-	LevelDebug
-	LevelInfo
-	LevelError
+	LevelUnknown Level = 0
+	LevelDebug   Level = 1
+	LevelInfo    Level = 2
+	LevelError   Level = 3
+	LevelTrace   Level = 4
+	LevelWarn    Level = 5
 )
 
+// levelSeverity orders the Levels from the most to the least verbose
+var levelSeverity = map[Level]int{
+	LevelUnknown: 0,
+	LevelTrace:   1,
+	LevelDebug:   2,
+	LevelInfo:    3,
+	LevelWarn:    4,
+	LevelError:   5,
+}
+
 // levelMap allows for a lookup of a Level's string representation
 var levelMap = map[Level]string{
 	LevelUnknown: "UNKNOWN",
+	LevelTrace:   "TRACE",
 	LevelDebug:   "DEBUG",
 	LevelInfo:    "INFO",
+	LevelWarn:    "WARN",
 	LevelError:   "ERROR",
 }
 
@@ -45,10 +101,34 @@ func (l Level) String() string {
 	return levelMap[0]
 }
 
+// AtLeast returns true if l is at least as severe as min. Every Level is at least
+// LevelUnknown
+func (l Level) AtLeast(min Level) bool {
+	return levelSeverity[l] >= levelSeverity[min]
+}
+
+// ParseLevel returns the Level with the given name, such as "debug" or "WARN"
+func ParseLevel(s string) (Level, error) {
+	for level, name := range levelMap {
+		if level != LevelUnknown && strings.EqualFold(s, name) {
+			return level, nil
+		}
+	}
+	if strings.EqualFold(s, "warning") {
+		return LevelWarn, nil
+	}
+	return LevelUnknown, fmt.Errorf("unknown log level '%s'", s)
+}
+
 // Msg holds information about a particular log message
 type Msg struct {
-	Time     int64  `json:"time"`
-	FuncName string `json:"func_name"`
-	Level    string `json:"level"`
-	Message  string `json:"message"`
+	Time      int64  `json:"time"`
+	Component string `json:"component,omitempty"`
+	FuncName  string `json:"func_name"`
+	Level     string `json:"level"`
+	Message   string `json:"message"`
+
+	// Fields holds structured key/value pairs. When a Msg is marshaled to JSON, these are
+	// written as top-level keys
+	Fields Fields `json:"-"`
 }
@@ -0,0 +1,64 @@
+package logr
+
+import "testing"
+
+func TestLevelValues(t *testing.T) {
+	// The values of the original Levels must never change
+	tests := []struct {
+		level Level
+		want  int
+	}{
+		{LevelUnknown, 0},
+		{LevelDebug, 1},
+		{LevelInfo, 2},
+		{LevelError, 3},
+	}
+	for _, tt := range tests {
+		if int(tt.level) != tt.want {
+			t.Errorf("%s = %d, want %d", tt.level, tt.level, tt.want)
+		}
+	}
+}
+
+func TestLevelAtLeast(t *testing.T) {
+	tests := []struct {
+		level, min Level
+		want       bool
+	}{
+		{LevelTrace, LevelUnknown, true},
+		{LevelTrace, LevelDebug, false},
+		{LevelDebug, LevelTrace, true},
+		{LevelDebug, LevelInfo, false},
+		{LevelInfo, LevelInfo, true},
+		{LevelWarn, LevelInfo, true},
+		{LevelWarn, LevelError, false},
+		{LevelError, LevelWarn, true},
+		{LevelUnknown, LevelInfo, false},
+	}
+	for _, tt := range tests {
+		if got := tt.level.AtLeast(tt.min); got != tt.want {
+			t.Errorf("%s.AtLeast(%s) = %v, want %v", tt.level, tt.min, got, tt.want)
+		}
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Level
+		wantErr bool
+	}{
+		{"debug", LevelDebug, false},
+		{"WARN", LevelWarn, false},
+		{"warning", LevelWarn, false},
+		{"trace", LevelTrace, false},
+		{"unknown", LevelUnknown, true},
+		{"loud", LevelUnknown, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseLevel(tt.in)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("ParseLevel(%q) = %s, %v", tt.in, got, err)
+		}
+	}
+}
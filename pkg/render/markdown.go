@@ -0,0 +1,151 @@
+package render
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// zeroWidthSpace is inserted into text that Keybase would otherwise treat specially, such
+// as mentions, in places where a backslash escape has no effect
+const zeroWidthSpace = "\u200b"
+
+// Markdown is a string that has already been rendered as Keybase markdown, and is safe to
+// include in a template without being escaped again
+type Markdown string
+
+// markdownEscaper escapes the characters Keybase uses for formatting
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	"*", `\*`,
+	"_", `\_`,
+	"~", `\~`,
+	"`", "\\`",
+	">", `\>`,
+)
+
+// mentionRegex matches @user, @here, @channel, and #channel style mentions, which are picked
+// up by the Keybase server from the raw message body regardless of any escaping
+var mentionRegex = regexp.MustCompile(`([@#])([\p{L}\p{N}_])`)
+
+// fenceRegex matches runs of backticks, which would end a code block early
+var fenceRegex = regexp.MustCompile("``+")
+
+// backtickRegex matches runs of one or more backticks
+var backtickRegex = regexp.MustCompile("`+")
+
+// toString turns any value into a string. Markdown values are returned as is
+func toString(v interface{}) string {
+	switch s := v.(type) {
+	case Markdown:
+		return string(s)
+	case string:
+		return s
+	case fmt.Stringer:
+		return s.String()
+	case error:
+		return s.Error()
+	}
+	return fmt.Sprint(v)
+}
+
+// defuseMentions breaks up mentions so they are displayed, but don't notify anyone
+func defuseMentions(s string) string {
+	return mentionRegex.ReplaceAllString(s, "$1"+zeroWidthSpace+"$2")
+}
+
+// defuseFences breaks up runs of backticks so they can't end a code block
+func defuseFences(s string) string {
+	return fenceRegex.ReplaceAllStringFunc(s, func(fence string) string {
+		return strings.Join(strings.Split(fence, ""), zeroWidthSpace)
+	})
+}
+
+// Escape returns s with all Keybase markdown formatting characters escaped, and with any
+// mentions broken up so they don't notify anyone. If v is already Markdown, it is returned
+// unchanged
+func Escape(v interface{}) Markdown {
+	if md, ok := v.(Markdown); ok {
+		return md
+	}
+	return Markdown(defuseMentions(markdownEscaper.Replace(toString(v))))
+}
+
+// Bold returns the escaped value in bold
+func Bold(v interface{}) Markdown {
+	return Markdown("*" + string(Escape(v)) + "*")
+}
+
+// Italic returns the escaped value in italics
+func Italic(v interface{}) Markdown {
+	return Markdown("_" + string(Escape(v)) + "_")
+}
+
+// Strike returns the escaped value with a strikethrough
+func Strike(v interface{}) Markdown {
+	return Markdown("~" + string(Escape(v)) + "~")
+}
+
+// Code returns the value as inline code. The code span is fenced with more backticks than
+// the longest run of backticks in the value, so nothing in the value can end it early
+func Code(v interface{}) Markdown {
+	s := defuseMentions(toString(v))
+	longest := 0
+	for _, run := range backtickRegex.FindAllString(s, -1) {
+		if len(run) > longest {
+			longest = len(run)
+		}
+	}
+	fence := strings.Repeat("`", longest+1)
+	if longest > 0 {
+		// padding keeps a backtick at either end of the value from joining the fence
+		s = " " + s + " "
+	}
+	return Markdown(fence + s + fence)
+}
+
+// CodeBlock returns the value as a fenced code block. Runs of backticks in the value are
+// broken up so they can't end the code block early
+func CodeBlock(v interface{}) Markdown {
+	s := strings.TrimRight(defuseFences(toString(v)), "\n")
+	return Markdown("```\n" + defuseMentions(s) + "\n```")
+}
+
+// Quote returns the escaped value as a block quote. Every line of the value is quoted
+func Quote(v interface{}) Markdown {
+	lines := strings.Split(string(Escape(v)), "\n")
+	for i, line := range lines {
+		lines[i] = "> " + line
+	}
+	return Markdown(strings.Join(lines, "\n"))
+}
+
+// Mention returns a mention of a Keybase user, which will notify them. Anything after the
+// first character that isn't valid in a Keybase username is escaped
+func Mention(user interface{}) Markdown {
+	name := strings.TrimPrefix(toString(user), "@")
+	end := 0
+	for end < len(name) {
+		c := name[end]
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_') {
+			break
+		}
+		end++
+	}
+	return Markdown("@" + name[:end] + string(Escape(name[end:])))
+}
+
+// Link returns a URL that Keybase will turn into a link. Only http and https URLs are
+// allowed; anything else is escaped and returned as plain text. Keybase does not support
+// links with separate text, so if text is not empty it is escaped and placed before the URL
+func Link(text interface{}, rawurl string) Markdown {
+	u, err := url.Parse(rawurl)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return Escape(rawurl)
+	}
+	if t := toString(text); t != "" {
+		return Markdown(string(Escape(t)) + ": " + u.String())
+	}
+	return Markdown(u.String())
+}
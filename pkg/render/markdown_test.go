@@ -0,0 +1,73 @@
+package render
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestEscape(t *testing.T) {
+	zw := zeroWidthSpace
+	tests := []struct {
+		name string
+		in   interface{}
+		want Markdown
+	}{
+		{"plain", "hello world", "hello world"},
+		{"formatting", "*bold* _it_ ~st~ `code`", `\*bold\* \_it\_ \~st\~ ` + "\\`code\\`"},
+		{"backslash", `a\b`, `a\\b`},
+		{"quote", "> quoted", `\> quoted`},
+		{"mention", "hi @alice", Markdown("hi @" + zw + "alice")},
+		{"channel", "see #general", Markdown("see #" + zw + "general")},
+		{"email", "a@b.com", Markdown("a@" + zw + "b.com")},
+		{"lone at", "@ and #", "@ and #"},
+		{"already markdown", Markdown("*kept*"), "*kept*"},
+		{"error", errors.New("bad_thing"), `bad\_thing`},
+		{"number", 42, "42"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Escape(tt.in); got != tt.want {
+				t.Errorf("Escape(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCode(t *testing.T) {
+	zw := zeroWidthSpace
+	tests := []struct {
+		name string
+		in   interface{}
+		want Markdown
+	}{
+		{"plain", "x := 1", "`x := 1`"},
+		{"formatting kept literal", "*bold*", "`*bold*`"},
+		{"mention", "@alice", Markdown("`@" + zw + "alice`")},
+		{"backtick", "a`b", "`` a`b ``"},
+		{"backtick run", "a```b`c", "```` a```b`c ````"},
+		{"backtick at ends", "`x`", "`` `x` ``"},
+		{"injection", "x` *bold* @here `y", Markdown("`` x` *bold* @" + zw + "here `y ``")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Code(tt.in); got != tt.want {
+				t.Errorf("Code(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCodeBlock(t *testing.T) {
+	got := string(CodeBlock("a\n```\nb @alice\n"))
+	if !strings.HasPrefix(got, "```\n") || !strings.HasSuffix(got, "\n```") {
+		t.Fatalf("CodeBlock is not fenced: %q", got)
+	}
+	inner := strings.TrimSuffix(strings.TrimPrefix(got, "```\n"), "\n```")
+	if strings.Contains(inner, "``") {
+		t.Errorf("CodeBlock left a fence inside the block: %q", got)
+	}
+	if strings.Contains(inner, "@alice") {
+		t.Errorf("CodeBlock left a mention inside the block: %q", got)
+	}
+}
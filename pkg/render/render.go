@@ -0,0 +1,154 @@
+// Package render renders chat replies from text/template templates. Values inserted into a
+// template are automatically escaped for Keybase markdown, so echoing user input can't
+// change the formatting of a reply, mention anyone, or break out of a code block. Use the
+// helpers (bold, code, codeblock, quote, mention, link, etc.) to add formatting, or the raw
+// function to insert trusted markdown without escaping it.
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"text/template"
+	"text/template/parse"
+)
+
+// escapeFunc is the name of the function that is appended to every action in a template
+const escapeFunc = "_kbEscape"
+
+// Renderer holds a set of templates that render to Keybase markdown
+type Renderer struct {
+	mu      sync.Mutex
+	tmpl    *template.Template
+	escaped map[*parse.Tree]bool
+}
+
+// Funcs returns the template functions that are available to every template
+func Funcs() template.FuncMap {
+	return template.FuncMap{
+		escapeFunc:  Escape,
+		"escape":    Escape,
+		"bold":      Bold,
+		"italic":    Italic,
+		"strike":    Strike,
+		"code":      Code,
+		"codeblock": CodeBlock,
+		"quote":     Quote,
+		"mention":   Mention,
+		"link":      Link,
+		"raw": func(v interface{}) Markdown {
+			return Markdown(toString(v))
+		},
+	}
+}
+
+// New returns an empty Renderer
+func New() *Renderer {
+	return &Renderer{
+		tmpl:    template.New("").Funcs(Funcs()),
+		escaped: make(map[*parse.Tree]bool),
+	}
+}
+
+// Parse adds a template with the given name
+func (r *Renderer) Parse(name, text string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, err := r.tmpl.New(name).Parse(text); err != nil {
+		return err
+	}
+	r.escapeTemplates()
+	return nil
+}
+
+// ParseFiles adds templates from files. Each template is named after the base name of its
+// file
+func (r *Renderer) ParseFiles(filenames ...string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, err := r.tmpl.ParseFiles(filenames...); err != nil {
+		return err
+	}
+	r.escapeTemplates()
+	return nil
+}
+
+// ParseGlob adds templates from every file matching a glob pattern. Each template is named
+// after the base name of its file
+func (r *Renderer) ParseGlob(pattern string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, err := r.tmpl.ParseGlob(pattern); err != nil {
+		return err
+	}
+	r.escapeTemplates()
+	return nil
+}
+
+// Render executes the named template with the given data
+func (r *Renderer) Render(name string, data interface{}) (string, error) {
+	r.mu.Lock()
+	t := r.tmpl.Lookup(name)
+	r.mu.Unlock()
+	if t == nil {
+		return "", fmt.Errorf("template '%s' not found", name)
+	}
+
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// escapeTemplates makes sure the output of every action in every template is escaped. The
+// caller must hold the lock
+func (r *Renderer) escapeTemplates() {
+	for _, t := range r.tmpl.Templates() {
+		if t.Tree == nil || r.escaped[t.Tree] {
+			continue
+		}
+		escapeNode(t.Tree, t.Tree.Root)
+		r.escaped[t.Tree] = true
+	}
+}
+
+// escapeNode walks a template's parse tree, and appends the escape function to the pipeline
+// of every action that prints a value
+func escapeNode(tree *parse.Tree, node parse.Node) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			escapeNode(tree, child)
+		}
+	case *parse.ActionNode:
+		// Actions that declare variables don't print anything
+		if len(n.Pipe.Decl) > 0 {
+			return
+		}
+		cmds := n.Pipe.Cmds
+		if len(cmds) > 0 {
+			if id, ok := cmds[len(cmds)-1].Args[0].(*parse.IdentifierNode); ok && id.Ident == escapeFunc {
+				return
+			}
+		}
+		escape := parse.NewIdentifier(escapeFunc).SetTree(tree).SetPos(n.Pos)
+		n.Pipe.Cmds = append(n.Pipe.Cmds, &parse.CommandNode{
+			NodeType: parse.NodeCommand,
+			Pos:      n.Pos,
+			Args:     []parse.Node{escape},
+		})
+	case *parse.IfNode:
+		escapeNode(tree, n.List)
+		escapeNode(tree, n.ElseList)
+	case *parse.RangeNode:
+		escapeNode(tree, n.List)
+		escapeNode(tree, n.ElseList)
+	case *parse.WithNode:
+		escapeNode(tree, n.List)
+		escapeNode(tree, n.ElseList)
+	}
+}
@@ -0,0 +1,36 @@
+package render
+
+import "testing"
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name string
+		tmpl string
+		data interface{}
+		want string
+	}{
+		{"escaped", "Hi {{.}}!", "*bob*", `Hi \*bob\*!`},
+		{"mention", "{{.}}", "@bob", "@" + zeroWidthSpace + "bob"},
+		{"raw", "{{raw .}}", "*bob*", "*bob*"},
+		{"raw markdown", "{{raw .}}", Markdown("*bob*"), "*bob*"},
+		{"raw number", "{{raw .}}", 42, "42"},
+		{"bold", "{{bold .}}", "x_y", `*x\_y*`},
+		{"markdown value", "{{.}}", Markdown("*safe*"), "*safe*"},
+		{"range", "{{range .}}[{{.}}]{{end}}", []string{"a*", "b"}, `[a\*][b]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := New()
+			if err := r.Parse(tt.name, tt.tmpl); err != nil {
+				t.Fatalf("Parse returned error: %v", err)
+			}
+			got, err := r.Render(tt.name, tt.data)
+			if err != nil {
+				t.Fatalf("Render returned error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Render = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
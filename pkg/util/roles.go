@@ -0,0 +1,163 @@
+package util
+
+import (
+	"strings"
+
+	"samhofi.us/x/keybase/v2"
+	"samhofi.us/x/keybase/v2/types/chat1"
+	"samhofi.us/x/keybase/v2/types/keybase1"
+)
+
+// These constants represent the known Keybase roles
+const (
+	RoleNone          = "none"
+	RoleRestrictedBot = "restrictedbot"
+	RoleBot           = "bot"
+	RoleReader        = "reader"
+	RoleWriter        = "writer"
+	RoleAdmin         = "admin"
+	RoleOwner         = "owner"
+)
+
+// roleRanks holds the ordering of the known Keybase roles. This is the same ordering the
+// Keybase client uses when comparing roles, where bots and restricted bots sit below readers
+var roleRanks = map[string]int{
+	RoleNone:          0,
+	RoleRestrictedBot: 1,
+	RoleBot:           2,
+	RoleReader:        3,
+	RoleWriter:        4,
+	RoleAdmin:         5,
+	RoleOwner:         6,
+}
+
+// ValidRole returns true if the given string is a known Keybase role, not including "none"
+func ValidRole(role string) bool {
+	rank, ok := roleRanks[strings.ToLower(role)]
+	return ok && rank > 0
+}
+
+// RoleAtLeast returns true if role is equal to or higher than min. Unknown roles are always
+// treated as lower than every known role
+func RoleAtLeast(role, min string) bool {
+	minRank, ok := roleRanks[strings.ToLower(min)]
+	if !ok {
+		return false
+	}
+	return roleRanks[strings.ToLower(role)] >= minRank
+}
+
+// ConvRole returns the role the given user has in a conversation, based on the
+// conversation's member list. If the user is not a member of the conversation, RoleNone is
+// returned
+func ConvRole(kb *keybase.Keybase, user string, conv chat1.ConvIDStr) (string, error) {
+	members, err := kb.ListMembersOfConversation(conv)
+	if err != nil {
+		return RoleNone, err
+	}
+
+	groups := []struct {
+		role    string
+		members []chat1.ConversationMember
+	}{
+		{RoleOwner, members.Owners},
+		{RoleAdmin, members.Admins},
+		{RoleWriter, members.Writers},
+		{RoleReader, members.Readers},
+		{RoleBot, members.Bots},
+		{RoleRestrictedBot, members.RestrictedBots},
+	}
+	for _, group := range groups {
+		for _, member := range group.members {
+			if strings.EqualFold(member.Username, user) {
+				return group.role, nil
+			}
+		}
+	}
+	return RoleNone, nil
+}
+
+// explicitTeamRole returns the role the user was explicitly given in a team, without
+// looking at any parent teams
+func explicitTeamRole(kb *keybase.Keybase, user, team string) (string, error) {
+	members, err := kb.ListMembersOfTeam(team)
+	if err != nil {
+		return RoleNone, err
+	}
+
+	groups := []struct {
+		role    string
+		members []keybase1.TeamMemberDetails
+	}{
+		{RoleOwner, members.Owners},
+		{RoleAdmin, members.Admins},
+		{RoleWriter, members.Writers},
+		{RoleReader, members.Readers},
+		{RoleBot, members.Bots},
+		{RoleRestrictedBot, members.RestrictedBots},
+	}
+	for _, group := range groups {
+		for _, member := range group.members {
+			if strings.EqualFold(member.Username, user) {
+				return group.role, nil
+			}
+		}
+	}
+	return RoleNone, nil
+}
+
+// TeamRole returns the effective role the given user has in a team. This takes the team
+// hierarchy into account, so an owner or admin of a parent team will be treated as an
+// (implicit) admin of every subteam below it, unless they have been explicitly given a
+// higher role in the subteam. If the user has no role in the team, RoleNone is returned
+func TeamRole(kb *keybase.Keybase, user, team string) (string, error) {
+	team = strings.ToLower(team)
+	role, err := explicitTeamRole(kb, user, team)
+	if err != nil {
+		return RoleNone, err
+	}
+	if RoleAtLeast(role, RoleAdmin) {
+		return role, nil
+	}
+
+	// Walk up the hierarchy looking for an ancestor team where the user is an admin or owner.
+	// We can't always list the members of a parent team (the bot may not be a member), so
+	// errors from ancestors are ignored
+	parts := strings.Split(team, ".")
+	for i := len(parts) - 1; i > 0; i-- {
+		parent := strings.Join(parts[:i], ".")
+		parentRole, err := explicitTeamRole(kb, user, parent)
+		if err != nil {
+			continue
+		}
+		if RoleAtLeast(parentRole, RoleAdmin) {
+			return RoleAdmin, nil
+		}
+	}
+	return role, nil
+}
+
+// HasMinTeamRole returns true if the given user has the given role or higher in the team,
+// including roles that are implied by admin or owner status in a parent team
+func HasMinTeamRole(kb *keybase.Keybase, role, user, team string) bool {
+	if !ValidRole(role) {
+		return false
+	}
+
+	userRole, err := TeamRole(kb, user, team)
+	if err != nil {
+		return false
+	}
+	return RoleAtLeast(userRole, role)
+}
+
+// HasMinChannelRole returns true if the given user has the given role or higher in the
+// channel. For team channels the user's team-level role is used, which means this will
+// work for big-team channels the user hasn't joined, and for implicit admins. For all other
+// conversations this falls back to HasMinRole
+func HasMinChannelRole(kb *keybase.Keybase, role, user string, channel chat1.ChatChannel, conv chat1.ConvIDStr) bool {
+	if channel.MembersType == keybase.TEAM {
+		return HasMinTeamRole(kb, role, user, channel.Name)
+	}
+	return HasMinRole(kb, role, user, conv)
+}
@@ -0,0 +1,45 @@
+package util
+
+import "testing"
+
+func TestRoleAtLeast(t *testing.T) {
+	tests := []struct {
+		role, min string
+		want      bool
+	}{
+		{RoleOwner, RoleAdmin, true},
+		{RoleAdmin, RoleAdmin, true},
+		{RoleWriter, RoleAdmin, false},
+		{RoleReader, RoleBot, true},
+		{RoleBot, RoleReader, false},
+		{RoleRestrictedBot, RoleBot, false},
+		{"ADMIN", "writer", true},
+		{"unknown", RoleRestrictedBot, false},
+		{RoleOwner, "unknown", false},
+		{RoleNone, RoleReader, false},
+	}
+	for _, tt := range tests {
+		if got := RoleAtLeast(tt.role, tt.min); got != tt.want {
+			t.Errorf("RoleAtLeast(%q, %q) = %v, want %v", tt.role, tt.min, got, tt.want)
+		}
+	}
+}
+
+func TestValidRole(t *testing.T) {
+	tests := []struct {
+		role string
+		want bool
+	}{
+		{RoleOwner, true},
+		{"Writer", true},
+		{RoleRestrictedBot, true},
+		{RoleNone, false},
+		{"", false},
+		{"superuser", false},
+	}
+	for _, tt := range tests {
+		if got := ValidRole(tt.role); got != tt.want {
+			t.Errorf("ValidRole(%q) = %v, want %v", tt.role, got, tt.want)
+		}
+	}
+}
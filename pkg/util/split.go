@@ -0,0 +1,152 @@
+package util
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// codeFence is the markdown that starts and ends a code block
+const codeFence = "```"
+
+// MinSplitLength is the smallest chunk size SplitMessage will use. Smaller sizes leave no
+// room to close and reopen code blocks, so they are raised to this
+const MinSplitLength = 64
+
+// closeFence is added to the end of a chunk that ends inside a code block
+const closeFence = "\n" + codeFence
+
+// splitter holds the state of a SplitMessage call
+type splitter struct {
+	max     int
+	chunks  []string
+	cur     strings.Builder
+	started bool // whether cur holds anything besides a reopened code fence
+	inFence bool
+	info    string // the info string (e.g. the language) of the open code block
+}
+
+// SplitMessage splits body into chunks that are no longer than max bytes. Chunks are split
+// on line boundaries where possible, and the line break at the split is dropped. Lines that
+// are too long on their own are split wherever they need to be, without adding anything
+// between the pieces. If a chunk ends inside a code block, the block is closed at the end of
+// the chunk and reopened, with the same info string, at the start of the next one, so every
+// chunk renders correctly on its own. If max is less than MinSplitLength, MinSplitLength is
+// used
+func SplitMessage(body string, max int) []string {
+	if max < MinSplitLength {
+		max = MinSplitLength
+	}
+	if len(body) <= max {
+		return []string{body}
+	}
+
+	s := &splitter{max: max, chunks: make([]string, 0)}
+	for _, line := range strings.Split(body, "\n") {
+		s.addLine(line)
+	}
+	if s.started {
+		// The body's own fences are left as they are at the very end
+		s.chunks = append(s.chunks, s.cur.String())
+	}
+	return s.chunks
+}
+
+// fits returns true if n more bytes fit in the current chunk, leaving room to close a code
+// block
+func (s *splitter) fits(n int) bool {
+	return s.cur.Len()+n+len(closeFence) <= s.max
+}
+
+// addLine adds a line to the current chunk, starting new chunks as needed
+func (s *splitter) addLine(line string) {
+	if s.started && s.fits(1+len(line)) {
+		s.cur.WriteString("\n")
+		s.write(line, true)
+		return
+	}
+	if s.started {
+		s.flush()
+	}
+
+	atLineStart := true
+	for !s.fits(len(line)) {
+		cut := cutPoint(line, s.max-s.cur.Len()-len(closeFence))
+		s.write(line[:cut], atLineStart)
+		s.flush()
+		line = line[cut:]
+		atLineStart = false
+	}
+	if atLineStart || line != "" {
+		s.write(line, atLineStart)
+	}
+}
+
+// write adds text to the current chunk, and keeps track of the code blocks it opens and
+// closes. atLineStart is true if text starts at the beginning of a line of the body
+func (s *splitter) write(text string, atLineStart bool) {
+	s.cur.WriteString(text)
+	s.started = true
+
+	for i := 0; ; {
+		j := strings.Index(text[i:], codeFence)
+		if j < 0 {
+			return
+		}
+		i += j
+		s.inFence = !s.inFence
+		s.info = ""
+		if s.inFence && i == 0 && atLineStart {
+			s.info = strings.TrimSpace(text[len(codeFence):])
+			if strings.Contains(s.info, codeFence) {
+				s.info = ""
+			}
+		}
+		i += len(codeFence)
+	}
+}
+
+// flush finishes the current chunk, closing any open code block, and starts a new chunk that
+// reopens it
+func (s *splitter) flush() {
+	chunk := s.cur.String()
+	if s.inFence {
+		chunk += closeFence
+	}
+	s.chunks = append(s.chunks, chunk)
+	s.cur.Reset()
+	s.started = false
+	if s.inFence {
+		// drop info strings that would take up too much of the chunk
+		if len(codeFence)+len(s.info)+1 > s.max/4 {
+			s.info = ""
+		}
+		s.cur.WriteString(codeFence + s.info + "\n")
+	}
+}
+
+// cutPoint returns where to split a line so the first piece is no longer than max bytes,
+// without splitting a multi-byte character or a run of backticks where possible
+func cutPoint(line string, max int) int {
+	if max >= len(line) {
+		return len(line)
+	}
+	if max < 1 {
+		max = 1
+	}
+
+	cut := max
+	for cut > 0 && !utf8.RuneStart(line[cut]) {
+		cut--
+	}
+	runeCut := cut
+	for cut > 0 && line[cut-1] == '`' && line[cut] == '`' {
+		cut--
+	}
+	if cut == 0 {
+		cut = runeCut
+	}
+	if cut == 0 {
+		cut = max
+	}
+	return cut
+}
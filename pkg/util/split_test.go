@@ -0,0 +1,93 @@
+package util
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSplitMessage(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		max  int
+	}{
+		{"short", "hello", 100},
+		{"tiny max", "abcdefghijklmnop", 8},
+		{"zero max", strings.Repeat("abc ", 100), 0},
+		{"lines", strings.Repeat("line of text\n", 50), 100},
+		{"long line", strings.Repeat("x", 1000), 100},
+		{"long line then text", strings.Repeat("y", 9992) + "abc\n" + strings.Repeat("z", 20), 10000},
+		{"multibyte", strings.Repeat("héllo wörld ✓ ", 100), 64},
+		{"code block", "intro\n```go\n" + strings.Repeat("fmt.Println(\"hi\")\n", 40) + "```\noutro", 200},
+		{"long code line", "```\n" + strings.Repeat("q", 500) + "\n```", 100},
+		{"backticks", strings.Repeat("`", 300), 64},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunks := SplitMessage(tt.body, tt.max)
+			max := tt.max
+			if max < MinSplitLength {
+				max = MinSplitLength
+			}
+			for i, c := range chunks {
+				if len(c) > max {
+					t.Errorf("chunk %d is %d bytes, want at most %d", i, len(c), max)
+				}
+				if !utf8.ValidString(c) {
+					t.Errorf("chunk %d splits a multi-byte character: %q", i, c)
+				}
+			}
+
+			// Without code blocks, the only change allowed is dropping the line break at
+			// a split
+			if !strings.Contains(tt.body, codeFence) {
+				joined := strings.Join(chunks, "")
+				if strings.ReplaceAll(joined, "\n", "") != strings.ReplaceAll(tt.body, "\n", "") {
+					t.Errorf("chunks changed the content of the body")
+				}
+				if strings.Count(joined, "\n") > strings.Count(tt.body, "\n") {
+					t.Errorf("chunks added line breaks to the body")
+				}
+			}
+		})
+	}
+}
+
+func TestSplitMessageNoInsertedBreaks(t *testing.T) {
+	body := strings.Repeat("y", 9992) + "abc\n" + strings.Repeat("z", 20)
+	for _, c := range SplitMessage(body, 10000) {
+		if strings.Contains(c, "y\nabc") {
+			t.Fatalf("a line break was inserted inside a line: %q", c[len(c)-20:])
+		}
+	}
+}
+
+func TestSplitMessageFences(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		max  int
+		info string
+	}{
+		{"plain block", "```\n" + strings.Repeat("some code\n", 40) + "```", 100, ""},
+		{"with language", "text\n```go\n" + strings.Repeat("x := 1\n", 60) + "```\nafter", 120, "go"},
+		{"long line in block", "```sh\n" + strings.Repeat("a", 400) + "\n```", 100, "sh"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunks := SplitMessage(tt.body, tt.max)
+			if len(chunks) < 2 {
+				t.Fatalf("body was not split: %d chunk", len(chunks))
+			}
+			for i, c := range chunks {
+				if n := strings.Count(c, codeFence); n%2 != 0 {
+					t.Errorf("chunk %d has unbalanced code fences: %q", i, c)
+				}
+				if i > 0 && strings.HasPrefix(c, codeFence) && !strings.HasPrefix(c, codeFence+tt.info+"\n") {
+					t.Errorf("chunk %d reopened the code block without its info string %q: %q", i, tt.info, c)
+				}
+			}
+		})
+	}
+}
@@ -2,7 +2,6 @@ package util
 
 import (
 	"fmt"
-	"strings"
 
 	"samhofi.us/x/keybase/v2"
 	"samhofi.us/x/keybase/v2/types/chat1"
@@ -27,59 +26,19 @@ func ChannelString(channel chat1.ChatChannel) string {
 	return fmt.Sprintf("%s#%s", channel.Name, channel.TopicName)
 }
 
-// HasMinRole returns true if the given user has the given role or higher in the converation
+// HasMinRole returns true if the given user has the given role or higher in the converation.
+// Bots and restricted bots are ranked below readers, so asking for "reader" will not match
+// a bot, but asking for "bot" will match any human member of the conversation. Note that
+// this only looks at the conversation's member list; use HasMinChannelRole or
+// HasMinTeamRole if you need implicit admins or team-level roles to be taken into account
 func HasMinRole(kb *keybase.Keybase, role string, user string, conv chat1.ConvIDStr) bool {
-	conversation, err := kb.ListMembersOfConversation(conv)
-	if err != nil {
-		return false
-	}
-
-	memberTypes := make(map[string]struct{})
-	memberTypes["owner"] = struct{}{}
-	memberTypes["admin"] = struct{}{}
-	memberTypes["writer"] = struct{}{}
-	memberTypes["reader"] = struct{}{}
-
-	if _, ok := memberTypes[strings.ToLower(role)]; !ok {
-		// invalid role
+	if !ValidRole(role) {
 		return false
 	}
 
-	for _, member := range conversation.Owners {
-		if strings.ToLower(member.Username) == strings.ToLower(user) {
-			return true
-		}
-	}
-	if strings.ToLower(role) == "owner" {
-		return false
-	}
-
-	for _, member := range conversation.Admins {
-		if strings.ToLower(member.Username) == strings.ToLower(user) {
-			return true
-		}
-	}
-	if strings.ToLower(role) == "admin" {
-		return false
-	}
-
-	for _, member := range conversation.Writers {
-		if strings.ToLower(member.Username) == strings.ToLower(user) {
-			return true
-		}
-	}
-	if strings.ToLower(role) == "writer" {
-		return false
-	}
-
-	for _, member := range conversation.Readers {
-		if strings.ToLower(member.Username) == strings.ToLower(user) {
-			return true
-		}
-	}
-	if strings.ToLower(role) == "reader" {
+	userRole, err := ConvRole(kb, user, conv)
+	if err != nil {
 		return false
 	}
-
-	return false
+	return RoleAtLeast(userRole, role)
 }
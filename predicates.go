@@ -0,0 +1,154 @@
+package keybasebot
+
+import (
+	"strings"
+
+	"github.com/kf5grd/keybasebot/pkg/util"
+	"samhofi.us/x/keybase/v2"
+	"samhofi.us/x/keybase/v2/types/chat1"
+)
+
+// Predicate reports whether a message meets some condition. Unlike an Adapter, a Predicate
+// does not wrap a BotAction, which means Predicates can be combined with Any, All, and Not
+// before being turned into an Adapter with When
+type Predicate func(chat1.MsgSummary, *Bot) bool
+
+// When returns an Adapter that only runs a command when the Predicate is true
+func When(p Predicate) Adapter {
+	return func(botAction BotAction) BotAction {
+		return func(m chat1.MsgSummary, b *Bot) (bool, error) {
+			if !p(m, b) {
+				b.LoggerFor(m).Debug("Predicate is false, exiting command")
+				return false, nil
+			}
+			b.LoggerFor(m).Debug("Predicate is true, continuing")
+			return botAction(m, b)
+		}
+	}
+}
+
+// Any returns a Predicate that is true when at least one of the given Predicates is true.
+// Predicates are evaluated in order, and evaluation stops at the first one that is true
+func Any(predicates ...Predicate) Predicate {
+	return func(m chat1.MsgSummary, b *Bot) bool {
+		for _, p := range predicates {
+			if p(m, b) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// All returns a Predicate that is true when every one of the given Predicates is true.
+// Predicates are evaluated in order, and evaluation stops at the first one that is false
+func All(predicates ...Predicate) Predicate {
+	return func(m chat1.MsgSummary, b *Bot) bool {
+		for _, p := range predicates {
+			if !p(m, b) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// Not returns a Predicate that is true when the given Predicate is false
+func Not(p Predicate) Predicate {
+	return func(m chat1.MsgSummary, b *Bot) bool {
+		return !p(m, b)
+	}
+}
+
+// AdapterPredicate turns an existing Adapter into a Predicate. The Predicate is true if the
+// Adapter would have allowed the command to run. Adapters that reply with an error when
+// they fail, like MinRole, are treated as false and their error is discarded
+func AdapterPredicate(a Adapter) Predicate {
+	return func(m chat1.MsgSummary, b *Bot) bool {
+		var reached bool
+		a(func(chat1.MsgSummary, *Bot) (bool, error) {
+			reached = true
+			return true, nil
+		})(m, b)
+		return reached
+	}
+}
+
+// IsMessageType returns a Predicate that is true when the message has the given type
+func IsMessageType(typeName string) Predicate {
+	return func(m chat1.MsgSummary, b *Bot) bool {
+		return m.Content.TypeName == typeName
+	}
+}
+
+// HasPrefix returns a Predicate that is true when a text message begins with the given
+// prefix. Messages that aren't text messages are always false
+func HasPrefix(prefix string) Predicate {
+	return func(m chat1.MsgSummary, b *Bot) bool {
+		if m.Content.TypeName != "text" || m.Content.Text == nil {
+			return false
+		}
+		return strings.HasPrefix(m.Content.Text.Body, prefix)
+	}
+}
+
+// IsFromUser returns a Predicate that is true when the message was sent by the given user
+func IsFromUser(user string) Predicate {
+	return func(m chat1.MsgSummary, b *Bot) bool {
+		return m.Sender.Username == user
+	}
+}
+
+// IsFromUsers returns a Predicate that is true when the message was sent by one of the given
+// users
+func IsFromUsers(users []string) Predicate {
+	return func(m chat1.MsgSummary, b *Bot) bool {
+		return util.StringInSlice(m.Sender.Username, users)
+	}
+}
+
+// HasMinRole returns a Predicate that is true when the sender has at least the given role in
+// the conversation the message was sent in. See MinRole for details on how roles are
+// resolved
+func HasMinRole(kb *keybase.Keybase, role string) Predicate {
+	return func(m chat1.MsgSummary, b *Bot) bool {
+		return util.HasMinChannelRole(kb, role, m.Sender.Username, m.Channel, m.ConvID)
+	}
+}
+
+// HasPermission returns a Predicate that is true when the sender has been granted the given
+// permission. See RequirePermission for details
+func HasPermission(permission string) Predicate {
+	return func(m chat1.MsgSummary, b *Bot) bool {
+		ok, err := b.HasPermission(m, m.Sender.Username, permission)
+		if err != nil {
+			b.LoggerFor(m).Error("Unable to look up permission '%s' for sender: %v", permission, err)
+			return false
+		}
+		return ok
+	}
+}
+
+// InConv returns a Predicate that is true when the message was sent in the given
+// conversation
+func InConv(conv chat1.ConvIDStr) Predicate {
+	return func(m chat1.MsgSummary, b *Bot) bool {
+		return m.ConvID == conv
+	}
+}
+
+// InTeam returns a Predicate that is true when the message was sent in any channel of the
+// given team
+func InTeam(team string) Predicate {
+	return func(m chat1.MsgSummary, b *Bot) bool {
+		return m.Channel.MembersType == keybase.TEAM && strings.EqualFold(m.Channel.Name, team)
+	}
+}
+
+// InChannel returns a Predicate that is true when the message was sent in the given team
+// channel
+func InChannel(team, channel string) Predicate {
+	return func(m chat1.MsgSummary, b *Bot) bool {
+		return InTeam(team)(m, b) && strings.EqualFold(m.Channel.TopicName, strings.TrimPrefix(channel, "#"))
+	}
+}
@@ -0,0 +1,126 @@
+package keybasebot
+
+import (
+	"errors"
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	"github.com/kf5grd/keybasebot/pkg/logr"
+	"samhofi.us/x/keybase/v2/types/chat1"
+)
+
+// recorder returns Predicates that record the order they were evaluated in
+type recorder struct {
+	calls []string
+}
+
+func (r *recorder) predicate(name string, result bool) Predicate {
+	return func(chat1.MsgSummary, *Bot) bool {
+		r.calls = append(r.calls, name)
+		return result
+	}
+}
+
+func TestCombinedPredicates(t *testing.T) {
+	tests := []struct {
+		name      string
+		build     func(r *recorder) Predicate
+		want      bool
+		wantCalls []string
+	}{
+		{"any empty", func(r *recorder) Predicate { return Any() }, false, nil},
+		{"any first true", func(r *recorder) Predicate {
+			return Any(r.predicate("a", true), r.predicate("b", true))
+		}, true, []string{"a"}},
+		{"any last true", func(r *recorder) Predicate {
+			return Any(r.predicate("a", false), r.predicate("b", true))
+		}, true, []string{"a", "b"}},
+		{"any none true", func(r *recorder) Predicate {
+			return Any(r.predicate("a", false), r.predicate("b", false))
+		}, false, []string{"a", "b"}},
+		{"all empty", func(r *recorder) Predicate { return All() }, true, nil},
+		{"all true", func(r *recorder) Predicate {
+			return All(r.predicate("a", true), r.predicate("b", true))
+		}, true, []string{"a", "b"}},
+		{"all first false", func(r *recorder) Predicate {
+			return All(r.predicate("a", false), r.predicate("b", true))
+		}, false, []string{"a"}},
+		{"not true", func(r *recorder) Predicate { return Not(r.predicate("a", true)) }, false, []string{"a"}},
+		{"not false", func(r *recorder) Predicate { return Not(r.predicate("a", false)) }, true, []string{"a"}},
+		{"nested", func(r *recorder) Predicate {
+			return All(r.predicate("a", true), Any(r.predicate("b", false), Not(r.predicate("c", false))), r.predicate("d", true))
+		}, true, []string{"a", "b", "c", "d"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &recorder{}
+			if got := tt.build(r)(chat1.MsgSummary{}, &Bot{}); got != tt.want {
+				t.Errorf("predicate = %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(r.calls, tt.wantCalls) {
+				t.Errorf("evaluated %v, want %v", r.calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestWhen(t *testing.T) {
+	errAction := errors.New("action failed")
+	tests := []struct {
+		name    string
+		pred    bool
+		wantOK  bool
+		wantErr error
+		wantRan bool
+	}{
+		{"true runs the action", true, true, errAction, true},
+		{"false skips the action", false, false, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				b      = &Bot{Logger: logr.New(ioutil.Discard, false, false)}
+				ran    bool
+				action = func(chat1.MsgSummary, *Bot) (bool, error) {
+					ran = true
+					return true, errAction
+				}
+				pred = func(chat1.MsgSummary, *Bot) bool { return tt.pred }
+			)
+			ok, err := When(pred)(action)(chat1.MsgSummary{}, b)
+			if ok != tt.wantOK || err != tt.wantErr || ran != tt.wantRan {
+				t.Errorf("When = %v, %v, ran %v; want %v, %v, ran %v", ok, err, ran, tt.wantOK, tt.wantErr, tt.wantRan)
+			}
+		})
+	}
+}
+
+func TestAdapterPredicate(t *testing.T) {
+	tests := []struct {
+		name    string
+		adapter Adapter
+		want    bool
+	}{
+		{"passes through", func(next BotAction) BotAction { return next }, true},
+		{"stops quietly", func(BotAction) BotAction {
+			return func(chat1.MsgSummary, *Bot) (bool, error) { return false, nil }
+		}, false},
+		{"stops with an error", func(BotAction) BotAction {
+			return func(chat1.MsgSummary, *Bot) (bool, error) { return true, errors.New("denied") }
+		}, false},
+		{"runs next but fails afterwards", func(next BotAction) BotAction {
+			return func(m chat1.MsgSummary, b *Bot) (bool, error) {
+				next(m, b)
+				return true, errors.New("late")
+			}
+		}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := AdapterPredicate(tt.adapter)(chat1.MsgSummary{}, &Bot{}); got != tt.want {
+				t.Errorf("AdapterPredicate = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,201 @@
+package keybasebot
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/kf5grd/keybasebot/pkg/logr"
+	"samhofi.us/x/keybase/v2/types/chat1"
+)
+
+// DefaultHourglass is the reaction used by Bot.StartHourglass and the Hourglass adapter
+const DefaultHourglass = ":hourglass_flowing_sand:"
+
+// spinnerFrames are shown in turn by Progress.Spin
+var spinnerFrames = []string{"◐", "◓", "◑", "◒"}
+
+// Progress is a placeholder reply that is edited in place while a long-running command
+// works, and replaced with the final result when the command is finished
+type Progress struct {
+	b    *Bot
+	m    chat1.MsgSummary
+	ctx  context.Context
+	stop context.CancelFunc
+
+	// The trace ID and logger of the message, which are kept because the Progress can be
+	// used after the command returns
+	trace  string
+	logger *logr.Logger
+
+	mu       sync.Mutex
+	msgID    chat1.MessageID
+	text     string
+	finished bool
+}
+
+// StartProgress sends a placeholder reply to a message with Bot.Reply, so it explodes if the
+// command has BotCommand.Ephemeral set. If text is empty, a translated "Working…" is used.
+// If the bot shuts down before Done or Fail is called, the placeholder is edited to say the
+// command was cancelled
+func (b *Bot) StartProgress(m chat1.MsgSummary, text string) (*Progress, error) {
+	if text == "" {
+		text = b.T(m, MsgProgressWorking)
+	}
+
+	res, err := b.Reply(m, "%s", text)
+	if err != nil {
+		return nil, err
+	}
+	if res.MessageID == nil {
+		return nil, fmt.Errorf("no message id returned for progress reply")
+	}
+
+	ctx, stop := context.WithCancel(b.Ctx())
+	p := &Progress{
+		b:      b,
+		m:      m,
+		ctx:    ctx,
+		stop:   stop,
+		trace:  b.TraceID(m),
+		logger: b.LoggerFor(m),
+		msgID:  *res.MessageID,
+		text:   text,
+	}
+	go func() {
+		<-ctx.Done()
+		p.mu.Lock()
+		finished := p.finished
+		p.mu.Unlock()
+		if !finished {
+			p.finish(b.T(m, MsgProgressCancelled))
+		}
+	}()
+	return p, nil
+}
+
+// Context returns a context that is cancelled when the bot shuts down, or when the Progress
+// is finished
+func (p *Progress) Context() context.Context {
+	return p.ctx
+}
+
+// edit replaces the text of the placeholder
+func (p *Progress) edit(text string) error {
+	var (
+		b     = p.b
+		m     = p.m
+		msgID = p.msgID
+	)
+	_, err := b.send(m.ConvID, "edit", p.trace, func() (chat1.SendRes, error) {
+		return b.KB.EditByConvID(m.ConvID, msgID, "%s", text)
+	})
+	return err
+}
+
+// Update replaces the text of the placeholder with a progress update
+func (p *Progress) Update(message string, a ...interface{}) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.finished {
+		return nil
+	}
+	p.text = fmt.Sprintf(message, a...)
+	return p.edit(p.text)
+}
+
+// Spin adds a spinner to the end of the placeholder, which moves every interval until the
+// Progress is finished. Keep the interval to a few seconds or more, since every frame is an
+// edit that counts against the bot's rate limits
+func (p *Progress) Spin(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for frame := 0; ; frame++ {
+			select {
+			case <-p.ctx.Done():
+				return
+			case <-ticker.C:
+				p.mu.Lock()
+				if !p.finished {
+					p.edit(fmt.Sprintf("%s %s", p.text, spinnerFrames[frame%len(spinnerFrames)]))
+				}
+				p.mu.Unlock()
+			}
+		}
+	}()
+}
+
+// finish stops the spinner and replaces the placeholder with its final text
+func (p *Progress) finish(text string) error {
+	p.mu.Lock()
+	if p.finished {
+		p.mu.Unlock()
+		return nil
+	}
+	p.finished = true
+	err := p.edit(text)
+	p.mu.Unlock()
+	p.stop()
+	return err
+}
+
+// Done replaces the placeholder with the final result
+func (p *Progress) Done(message string, a ...interface{}) error {
+	return p.finish(fmt.Sprintf(message, a...))
+}
+
+// Fail replaces the placeholder with an error. Only the user-safe part of the error is
+// shown; see UserError
+func (p *Progress) Fail(err error) error {
+	reply, err := p.b.userMessage(p.m, err)
+	p.logger.With("error", err).Error("Command failed: %v", err)
+	return p.finish(reply)
+}
+
+// StartHourglass adds an hourglass reaction to a message, and returns a function that
+// removes it again. The reaction is also removed if the bot shuts down first
+func (b *Bot) StartHourglass(m chat1.MsgSummary) func() {
+	trace := b.TraceID(m)
+	res, err := b.send(m.ConvID, "reaction", trace, func() (chat1.SendRes, error) {
+		return b.KB.ReactByConvID(m.ConvID, m.Id, DefaultHourglass)
+	})
+	if err != nil || res.MessageID == nil {
+		b.LoggerFor(m).Error("Unable to add hourglass to message %d: %v", m.Id, err)
+		return func() {}
+	}
+
+	var (
+		reaction    = *res.MessageID
+		once        sync.Once
+		ctx, cancel = context.WithCancel(b.Ctx())
+	)
+	remove := func() {
+		once.Do(func() {
+			cancel()
+			b.sendAsync(m.ConvID, "delete", trace, func() (chat1.SendRes, error) {
+				return b.KB.DeleteByConvID(m.ConvID, reaction)
+			})
+		})
+	}
+	go func() {
+		<-ctx.Done()
+		remove()
+	}()
+	return remove
+}
+
+// Hourglass returns an Adapter that adds an hourglass reaction to the message while the
+// command runs, and removes it when the command returns. This should be passed after the
+// adapters that decide whether the command applies to the message, so the hourglass only
+// shows up on messages the command actually handles
+func Hourglass() Adapter {
+	return func(botAction BotAction) BotAction {
+		return func(m chat1.MsgSummary, b *Bot) (bool, error) {
+			done := b.StartHourglass(m)
+			defer done()
+			return botAction(m, b)
+		}
+	}
+}
@@ -0,0 +1,281 @@
+package keybasebot
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"samhofi.us/x/keybase/v2/types/chat1"
+)
+
+// defaultMaxTrackedMessages is the number of triggering messages whose replies we keep track
+// of before we start forgetting the oldest ones
+const defaultMaxTrackedMessages = 1000
+
+// DefaultReplyTrackingWindow is how long the bot remembers its replies to a message when
+// Bot.ReplyTrackingWindow is not changed
+const DefaultReplyTrackingWindow = time.Hour
+
+// msgKey uniquely identifies a message across all conversations
+type msgKey struct {
+	ConvID chat1.ConvIDStr
+	MsgID  chat1.MessageID
+}
+
+// trackedReplies holds the replies and reactions the bot has sent in response to a single
+// message
+type trackedReplies struct {
+	Time      time.Time
+	Replies   []chat1.MessageID
+	Reactions []chat1.MessageID
+
+	// Retract is true if the command that handled the message wants its replies deleted when
+	// the message is deleted
+	Retract bool
+
+	// claimed is true once a command has been recorded as the owner of the replies
+	claimed bool
+
+	// cursor is used while an edited message is being re-dispatched, and points to the next
+	// reply that should be edited rather than sent as a new message
+	cursor int
+}
+
+// replyTracker keeps a bounded record of which messages the bot has sent in response to
+// which triggering messages
+type replyTracker struct {
+	mu      sync.Mutex
+	max     int
+	window  time.Duration
+	order   []msgKey
+	entries map[msgKey]*trackedReplies
+}
+
+func newReplyTracker(max int, window time.Duration) *replyTracker {
+	return &replyTracker{
+		max:     max,
+		window:  window,
+		order:   make([]msgKey, 0),
+		entries: make(map[msgKey]*trackedReplies),
+	}
+}
+
+// prune forgets entries that are older than the tracking window. The caller must hold the
+// lock
+func (t *replyTracker) prune() {
+	if t.window <= 0 {
+		return
+	}
+	cutoff := time.Now().Add(-t.window)
+	for len(t.order) > 0 {
+		e, ok := t.entries[t.order[0]]
+		if ok && e.Time.After(cutoff) {
+			return
+		}
+		delete(t.entries, t.order[0])
+		t.order = t.order[1:]
+	}
+}
+
+// entry returns the entry for a trigger, creating it if necessary. The caller must hold the
+// lock
+func (t *replyTracker) entry(key msgKey) *trackedReplies {
+	t.prune()
+	if e, ok := t.entries[key]; ok {
+		return e
+	}
+
+	e := &trackedReplies{
+		Time:      time.Now(),
+		Replies:   make([]chat1.MessageID, 0),
+		Reactions: make([]chat1.MessageID, 0),
+	}
+	t.entries[key] = e
+	t.order = append(t.order, key)
+	for len(t.order) > t.max {
+		delete(t.entries, t.order[0])
+		t.order = t.order[1:]
+	}
+	return e
+}
+
+// add records a reply to a trigger
+func (t *replyTracker) add(key msgKey, reply chat1.MessageID) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	e := t.entry(key)
+	e.Replies = append(e.Replies, reply)
+	e.cursor = len(e.Replies)
+}
+
+// addReaction records a reaction to a trigger
+func (t *replyTracker) addReaction(key msgKey, reaction chat1.MessageID) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	e := t.entry(key)
+	e.Reactions = append(e.Reactions, reaction)
+}
+
+// claim records whether the replies to a trigger should be retracted when the trigger is
+// deleted. Only the first command to reply to a trigger can claim it
+func (t *replyTracker) claim(key msgKey, retract bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	e, ok := t.entries[key]
+	if !ok || e.claimed {
+		return
+	}
+	e.claimed = true
+	e.Retract = retract
+}
+
+// remove forgets a trigger, and returns what we knew about it
+func (t *replyTracker) remove(key msgKey) (trackedReplies, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.prune()
+	e, ok := t.entries[key]
+	if !ok {
+		return trackedReplies{}, false
+	}
+	delete(t.entries, key)
+	for i, k := range t.order {
+		if k == key {
+			t.order = append(t.order[:i], t.order[i+1:]...)
+			break
+		}
+	}
+	return *e, true
+}
+
+// rewind resets the edit cursor for a trigger so that the next replies sent in response to
+// it will edit the existing replies in order
+func (t *replyTracker) rewind(key msgKey) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if e, ok := t.entries[key]; ok {
+		e.cursor = 0
+	}
+}
+
+// next returns the next existing reply that should be edited for a trigger, and advances the
+// edit cursor. If there are no replies left to edit, false is returned
+func (t *replyTracker) next(key msgKey) (chat1.MessageID, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	e, ok := t.entries[key]
+	if !ok || e.cursor >= len(e.Replies) {
+		return 0, false
+	}
+	reply := e.Replies[e.cursor]
+	e.cursor++
+	return reply, true
+}
+
+// IsEdit returns true if the message is an edit, including edits that have been rewritten
+// as text messages because Bot.HandleEdits is enabled
+func IsEdit(m chat1.MsgSummary) bool {
+	return m.Content.TypeName == "edit" || m.Content.Edit != nil
+}
+
+// editAsText rewrites an edit message so that it looks like the original text message with
+// the new body. The message ID is replaced with the ID of the message that was edited, so
+// that replies are threaded to the original message, and the Edit content is left in place
+// so that IsEdit can still identify it. Edits don't say which message the original was a
+// reply to, so that has to be passed in as replyTo
+func editAsText(m chat1.MsgSummary, replyTo *chat1.MessageID) chat1.MsgSummary {
+	if m.Content.Edit == nil {
+		return m
+	}
+	m.Id = m.Content.Edit.MessageID
+	m.Content.TypeName = "text"
+	m.Content.Text = &chat1.MessageText{Body: m.Content.Edit.Body, ReplyTo: replyTo}
+	return m
+}
+
+// Reply sends a reply to a message, and keeps track of it so that it can be updated later.
+// If the message is an edit that has been re-dispatched because Bot.HandleEdits is enabled,
+// and the bot already replied to the original message, the existing reply is edited instead
+// of a new one being sent. If the command handling the message has BotCommand.Ephemeral
+// set, the reply is sent as an exploding message
+func (b *Bot) Reply(m chat1.MsgSummary, message string, a ...interface{}) (chat1.SendRes, error) {
+	if lifetime := b.replyLifetime(m); lifetime > 0 {
+		return b.ReplyEphemeral(m, lifetime, message, a...)
+	}
+	return b.sendReply(m, fmt.Sprintf(message, a...))
+}
+
+// editReply edits the next existing reply to a message if the message is a re-dispatched
+// edit. It returns false if there was no reply to edit, and nothing was sent
+func (b *Bot) editReply(m chat1.MsgSummary, body string) (chat1.SendRes, bool, error) {
+	if !IsEdit(m) {
+		return chat1.SendRes{}, false, nil
+	}
+	reply, ok := b.replies.next(msgKey{ConvID: m.ConvID, MsgID: m.Id})
+	if !ok {
+		return chat1.SendRes{}, false, nil
+	}
+	b.LoggerFor(m).Debug("Editing previous reply %d to message %d", reply, m.Id)
+	res, err := b.send(m.ConvID, "edit", b.TraceID(m), func() (chat1.SendRes, error) {
+		return b.KB.EditByConvID(m.ConvID, reply, "%s", body)
+	})
+	return res, true, err
+}
+
+// sendReply sends a normal reply to a message, or edits the previous reply if the message is
+// a re-dispatched edit
+func (b *Bot) sendReply(m chat1.MsgSummary, body string) (chat1.SendRes, error) {
+	if res, ok, err := b.editReply(m, body); ok {
+		return res, err
+	}
+
+	key := msgKey{ConvID: m.ConvID, MsgID: m.Id}
+	res, err := b.send(m.ConvID, "reply", b.TraceID(m), func() (chat1.SendRes, error) {
+		return b.KB.ReplyByConvID(m.ConvID, m.Id, "%s", body)
+	})
+	if err != nil {
+		return res, err
+	}
+	if res.MessageID != nil {
+		b.replies.add(key, *res.MessageID)
+	}
+	return res, nil
+}
+
+// React sends a reaction to a message, and keeps track of it so that it can be removed if
+// the message is deleted
+func (b *Bot) React(m chat1.MsgSummary, reaction string) (chat1.SendRes, error) {
+	res, err := b.send(m.ConvID, "reaction", b.TraceID(m), func() (chat1.SendRes, error) {
+		return b.KB.ReactByConvID(m.ConvID, m.Id, reaction)
+	})
+	if err != nil {
+		return res, err
+	}
+	if res.MessageID != nil {
+		b.replies.addReaction(msgKey{ConvID: m.ConvID, MsgID: m.Id}, *res.MessageID)
+	}
+	return res, nil
+}
+
+// retractReplies deletes the replies and reactions the bot sent in response to messages that
+// have just been deleted, as long as the command that sent them has RetractOnDelete set
+func (b *Bot) retractReplies(m chat1.MsgSummary) {
+	if m.Content.Delete == nil {
+		return
+	}
+
+	for _, id := range m.Content.Delete.MessageIDs {
+		tracked, ok := b.replies.remove(msgKey{ConvID: m.ConvID, MsgID: id})
+		if !ok || !tracked.Retract {
+			continue
+		}
+
+		b.LoggerFor(m).Debug("Message %d was deleted, retracting %d replies and %d reactions", id, len(tracked.Replies), len(tracked.Reactions))
+		for _, reply := range append(tracked.Replies, tracked.Reactions...) {
+			reply := reply
+			b.sendAsync(m.ConvID, "delete", b.TraceID(m), func() (chat1.SendRes, error) {
+				return b.KB.DeleteByConvID(m.ConvID, reply)
+			})
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package keybasebot
+
+import (
+	"testing"
+
+	"samhofi.us/x/keybase/v2/types/chat1"
+)
+
+func TestEditAsText(t *testing.T) {
+	parent := chat1.MessageID(3)
+	tests := []struct {
+		name    string
+		replyTo *chat1.MessageID
+	}{
+		{"not a reply", nil},
+		{"reply", &parent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := chat1.MsgSummary{
+				Id:     10,
+				ConvID: "conv",
+				Content: chat1.MsgContent{
+					TypeName: "edit",
+					Edit:     &chat1.MessageEdit{MessageID: 7, Body: "!cmd fixed"},
+				},
+			}
+			got := editAsText(m, tt.replyTo)
+			if got.Id != 7 {
+				t.Errorf("Id = %d, want 7", got.Id)
+			}
+			if got.Content.TypeName != "text" || got.Content.Text == nil {
+				t.Fatalf("edit was not rewritten as a text message: %+v", got.Content)
+			}
+			if got.Content.Text.Body != "!cmd fixed" {
+				t.Errorf("Body = %q, want %q", got.Content.Text.Body, "!cmd fixed")
+			}
+			if got.Content.Text.ReplyTo != tt.replyTo {
+				t.Errorf("ReplyTo = %v, want %v", got.Content.Text.ReplyTo, tt.replyTo)
+			}
+			if !IsEdit(got) {
+				t.Error("rewritten edit is not recognized by IsEdit")
+			}
+		})
+	}
+}
+
+func TestMessageCacheRemove(t *testing.T) {
+	c := newMessageCache(2)
+	a := msgKey{ConvID: "conv", MsgID: 1}
+	b := msgKey{ConvID: "conv", MsgID: 2}
+	c.put(a, chat1.MsgSummary{Id: 1})
+	c.put(b, chat1.MsgSummary{Id: 2})
+	c.remove(a)
+	if _, ok := c.get(a); ok {
+		t.Error("removed message is still cached")
+	}
+	c.put(msgKey{ConvID: "conv", MsgID: 3}, chat1.MsgSummary{Id: 3})
+	if _, ok := c.get(b); !ok {
+		t.Error("message was evicted even though the cache was not full")
+	}
+}
@@ -0,0 +1,167 @@
+package keybasebot
+
+import "samhofi.us/x/keybase/v2/types/chat1"
+
+// Outcome describes what a command did with a message
+type Outcome int
+
+// These constants represent the possible Outcomes
+const (
+	// OutcomeNotMatched means the command doesn't apply to the message, and the bot should
+	// try the next command
+	OutcomeNotMatched Outcome = iota
+
+	// OutcomeHandled means the command handled the message, and the bot should not try any
+	// other commands
+	OutcomeHandled
+
+	// OutcomeHandledWithUserError means the command handled the message but failed, and the
+	// error should be sent back to the chat. The bot will not try any other commands
+	OutcomeHandledWithUserError
+
+	// OutcomeContinue means the command handled the message, but the bot should still try
+	// the commands after it
+	OutcomeContinue
+)
+
+// outcomeMap allows for a lookup of an Outcome's string representation
+var outcomeMap = map[Outcome]string{
+	OutcomeNotMatched:           "not matched",
+	OutcomeHandled:              "handled",
+	OutcomeHandledWithUserError: "handled with user error",
+	OutcomeContinue:             "continue",
+}
+
+// String returns a string representation of an Outcome
+func (o Outcome) String() string {
+	if s, ok := outcomeMap[o]; ok {
+		return s
+	}
+	return "unknown"
+}
+
+// Result is returned by a ResultAction to tell the bot what it did with a message
+type Result struct {
+	Outcome Outcome
+
+	// Err is sent back to the chat when Outcome is OutcomeHandledWithUserError. For every
+	// other Outcome, it is only logged
+	Err error
+}
+
+// ResultAction is like a BotAction, but returns a Result that says exactly what the command
+// did with the message
+type ResultAction func(chat1.MsgSummary, *Bot) Result
+
+// Handled returns a Result saying the command handled the message
+func Handled() Result {
+	return Result{Outcome: OutcomeHandled}
+}
+
+// NotMatched returns a Result saying the command doesn't apply to the message
+func NotMatched() Result {
+	return Result{Outcome: OutcomeNotMatched}
+}
+
+// HandledWithUserError returns a Result saying the command handled the message but failed,
+// and err should be sent back to the chat. Use a UserError to control which part of the
+// error is shown
+func HandledWithUserError(err error) Result {
+	return Result{Outcome: OutcomeHandledWithUserError, Err: err}
+}
+
+// Continue returns a Result saying the command handled the message, but the bot should
+// still try the commands after it
+func Continue() Result {
+	return Result{Outcome: OutcomeContinue}
+}
+
+// WithError returns a copy of the Result with an error attached. Unless the Outcome is
+// OutcomeHandledWithUserError, the error is only logged
+func (r Result) WithError(err error) Result {
+	r.Err = err
+	return r
+}
+
+// legacy converts the Result to the (bool, error) returned by a BotAction
+func (r Result) legacy() (bool, error) {
+	switch r.Outcome {
+	case OutcomeHandled, OutcomeHandledWithUserError:
+		return true, r.Err
+	}
+	return false, r.Err
+}
+
+// legacyResult converts the (bool, error) returned by a BotAction to a Result
+func legacyResult(ok bool, err error) Result {
+	switch {
+	case ok && err != nil:
+		return HandledWithUserError(err)
+	case ok:
+		return Handled()
+	}
+	return NotMatched().WithError(err)
+}
+
+// Legacy turns a BotAction into a ResultAction. true with no error is OutcomeHandled, true
+// with an error is OutcomeHandledWithUserError, and false is OutcomeNotMatched, with any
+// error only being logged
+func Legacy(botAction BotAction) ResultAction {
+	return func(m chat1.MsgSummary, b *Bot) Result {
+		return legacyResult(botAction(m, b))
+	}
+}
+
+// FromResult turns a ResultAction into a BotAction, so it can be used anywhere a BotAction is
+// expected. OutcomeContinue becomes false, so the distinction between it and
+// OutcomeNotMatched is lost
+func FromResult(resultAction ResultAction) BotAction {
+	return func(m chat1.MsgSummary, b *Bot) (bool, error) {
+		return resultAction(m, b).legacy()
+	}
+}
+
+// sameError returns true if a and b are the same error. Comparing errors can panic even when
+// their types look comparable, such as a struct holding an error whose dynamic type is a
+// slice, so those errors are never considered the same
+func sameError(a, b error) (same bool) {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	defer func() {
+		if recover() != nil {
+			same = false
+		}
+	}()
+	return a == b
+}
+
+// AdaptResult is like Adapt, but for a ResultAction. The ResultAction's Result is passed
+// through the adapters unchanged, unless an adapter changes it or stops the ResultAction
+// from running
+func AdaptResult(resultAction ResultAction, adapters ...Adapter) ResultAction {
+	return func(m chat1.MsgSummary, b *Bot) Result {
+		var inner *Result
+		ok, err := Adapt(func(m chat1.MsgSummary, b *Bot) (bool, error) {
+			r := resultAction(m, b)
+			inner = &r
+			return r.legacy()
+		}, adapters...)(m, b)
+
+		if inner != nil {
+			innerOK, innerErr := inner.legacy()
+			if ok == innerOK && sameError(err, innerErr) {
+				return *inner
+			}
+		}
+		return legacyResult(ok, err)
+	}
+}
+
+// action returns the ResultAction for a command
+func (c *BotCommand) action() ResultAction {
+	if c.Handle != nil {
+		return c.Handle
+	}
+	return Legacy(c.Run)
+}
@@ -0,0 +1,91 @@
+package keybasebot
+
+import (
+	"errors"
+	"testing"
+
+	"samhofi.us/x/keybase/v2/types/chat1"
+)
+
+// sliceError is an error type that can't be compared
+type sliceError []string
+
+func (e sliceError) Error() string { return "slice error" }
+
+func TestLegacyResult(t *testing.T) {
+	err := errors.New("boom")
+	tests := []struct {
+		name    string
+		ok      bool
+		err     error
+		outcome Outcome
+		wantErr error
+	}{
+		{"handled", true, nil, OutcomeHandled, nil},
+		{"user error", true, err, OutcomeHandledWithUserError, err},
+		{"not matched", false, nil, OutcomeNotMatched, nil},
+		{"not matched with error", false, err, OutcomeNotMatched, err},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := legacyResult(tt.ok, tt.err)
+			if r.Outcome != tt.outcome || r.Err != tt.wantErr {
+				t.Errorf("legacyResult(%v, %v) = %v, %v, want %v, %v", tt.ok, tt.err, r.Outcome, r.Err, tt.outcome, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSameError(t *testing.T) {
+	err := errors.New("boom")
+	wrapped := ephemeralError{err: sliceError{"a"}}
+	tests := []struct {
+		name string
+		a, b error
+		want bool
+	}{
+		{"both nil", nil, nil, true},
+		{"one nil", err, nil, false},
+		{"same", err, err, true},
+		{"different", err, errors.New("boom"), false},
+		{"uncomparable", sliceError{"a"}, sliceError{"a"}, false},
+		{"struct holding uncomparable", wrapped, wrapped, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sameError(tt.a, tt.b); got != tt.want {
+				t.Errorf("sameError = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAdaptResult(t *testing.T) {
+	var (
+		m    = chat1.MsgSummary{}
+		b    = &Bot{}
+		skip = func(BotAction) BotAction {
+			return func(chat1.MsgSummary, *Bot) (bool, error) { return false, nil }
+		}
+		pass = func(next BotAction) BotAction { return next }
+	)
+	tests := []struct {
+		name    string
+		result  Result
+		adapter Adapter
+		want    Outcome
+	}{
+		{"continue passes through", Continue(), pass, OutcomeContinue},
+		{"handled passes through", Handled(), pass, OutcomeHandled},
+		{"adapter stops the action", Handled(), skip, OutcomeNotMatched},
+		{"uncomparable error", HandledWithUserError(ephemeralError{err: sliceError{"a"}}), pass, OutcomeHandledWithUserError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			action := AdaptResult(func(chat1.MsgSummary, *Bot) Result { return tt.result }, tt.adapter)
+			if got := action(m, b); got.Outcome != tt.want {
+				t.Errorf("Outcome = %v, want %v", got.Outcome, tt.want)
+			}
+		})
+	}
+}
@@ -1,35 +1,189 @@
 package keybasebot
 
 import (
+	"context"
+	"sync"
+
 	"github.com/kf5grd/keybasebot/pkg/logr"
+	"samhofi.us/x/keybase/v2"
+	"samhofi.us/x/keybase/v2/types/chat1"
 )
 
-// Run starts the bot listening for new messages
+// lifecycle holds the bot's context, and keeps track of the message listener and the
+// handlers it is running. It is shared by every copy of the Bot
+type lifecycle struct {
+	mu       sync.Mutex
+	ctx      context.Context
+	cancel   context.CancelFunc
+	running  bool
+	listener chan struct{}
+	inflight sync.WaitGroup
+}
+
+func newLifecycle() *lifecycle {
+	l := &lifecycle{}
+	l.ctx, l.cancel = context.WithCancel(context.Background())
+	return l
+}
+
+// start marks the bot as running and returns its context. If the bot was shut down before,
+// a new context is created
+func (l *lifecycle) start() context.Context {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.ctx.Err() != nil {
+		l.ctx, l.cancel = context.WithCancel(context.Background())
+	}
+	l.running = true
+	return l.ctx
+}
+
+// stop cancels the bot's context, stops new messages from being handled, and waits for the
+// handlers that are already running to return. It is safe to call more than once
+func (l *lifecycle) stop() {
+	l.mu.Lock()
+	l.running = false
+	l.cancel()
+	l.mu.Unlock()
+	l.inflight.Wait()
+}
+
+// enter reports whether a handler may run. If it returns true, leave must be called when
+// the handler returns
+func (l *lifecycle) enter() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.running {
+		return false
+	}
+	l.inflight.Add(1)
+	return true
+}
+
+func (l *lifecycle) leave() {
+	l.inflight.Done()
+}
+
+// listen starts the message listener, unless one started by an earlier call to Run is still
+// going, and returns a channel that is closed when it stops
+func (l *lifecycle) listen(kb *keybase.Keybase, h keybase.Handlers, opts *keybase.RunOptions) <-chan struct{} {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.listener != nil {
+		select {
+		case <-l.listener:
+		default:
+			return l.listener
+		}
+	}
+	done := make(chan struct{})
+	l.listener = done
+	go func() {
+		defer close(done)
+		kb.Run(l.gate(h), opts)
+	}()
+	return done
+}
+
+// gate wraps the handlers so that they only run while the bot is running
+func (l *lifecycle) gate(h keybase.Handlers) keybase.Handlers {
+	if h.ChatHandler != nil {
+		next := *h.ChatHandler
+		chat := func(m chat1.MsgSummary) {
+			if !l.enter() {
+				return
+			}
+			defer l.leave()
+			next(m)
+		}
+		h.ChatHandler = &chat
+	}
+	if h.ErrorHandler != nil {
+		next := *h.ErrorHandler
+		errHandler := func(err error) {
+			if !l.enter() {
+				return
+			}
+			defer l.leave()
+			next(err)
+		}
+		h.ErrorHandler = &errHandler
+	}
+	return h
+}
+
+// Run starts the bot listening for new messages. Run returns when the message listener
+// stops, or when Shutdown is called. Before returning, Run waits for the messages that are
+// being handled to finish.
+//
+// The keybase library has no way to stop its message listener, so after Shutdown the
+// listener is left running but the messages it receives are dropped. Calling Run again
+// reuses it
 func (b *Bot) Run() error {
 	// set up logger
-	logWriter := convWriter{
-		// if convID is empty (which is the default) then logs will only be written to stdout,
-		// but if a conversation id is passed here then logs will be written to stdout *and*
-		// this conversation
-		ConvID: b.LogConv,
-		Writer: b.LogWriter,
-		KB:     b.KB,
+	b.Logger = logr.New(b.LogWriter, b.Debug, b.JSON)
+	b.Logger.Handler = b.logHandler()
+	if b.HashLogIdentities {
+		if b.LogRedactor == nil {
+			b.LogRedactor = logr.NewRedactor()
+		}
+		b.LogRedactor.HashFields(identityFields...)
 	}
-	b.Logger = logr.New(logWriter, b.Debug, b.JSON)
+	b.Logger.Redactor = b.LogRedactor
+	b.Logger.MinLevel = b.LogLevel
+	for component, level := range b.LogLevels {
+		b.Logger.SetLevel(component, level)
+	}
+	b.replies = newReplyTracker(defaultMaxTrackedMessages, b.ReplyTrackingWindow)
 
 	b.registerHandlers()
+	b.loadDialogs()
 	b.AdvertiseCommands()
 	defer b.ClearCommands()
 
+	ctx := b.life.start()
+	defer b.life.stop()
+	if b.logConv != nil {
+		go b.logConv.run(ctx)
+	}
+	go b.sweepState(ctx)
+
 	b.Logger.Info("Running as user %s", b.KB.Username)
-	b.running = true
-	b.KB.Run(b.Handlers, &b.Opts)
-	b.running = false
+	done := b.life.listen(b.KB, b.Handlers, &b.Opts)
+	select {
+	case <-done:
+	case <-ctx.Done():
+		b.Logger.Info("Shutting down")
+	}
+	b.life.stop()
+
+	// send whatever is left in the log conversation's buffer before returning
+	if b.logConv != nil {
+		<-b.logConv.done
+	}
 
 	return nil
 }
 
+// Shutdown stops the bot. The context returned by Ctx is cancelled, so long-running commands
+// can stop what they're doing, and Run returns
+func (b *Bot) Shutdown() {
+	b.life.mu.Lock()
+	defer b.life.mu.Unlock()
+	b.life.cancel()
+}
+
+// Ctx returns a context that is cancelled when the bot shuts down. Long-running commands
+// should watch this so they can stop early
+func (b *Bot) Ctx() context.Context {
+	b.life.mu.Lock()
+	defer b.life.mu.Unlock()
+	return b.life.ctx
+}
+
 // Running indicates whether the bot is currently running
 func (b *Bot) Running() bool {
-	return b.running
+	b.life.mu.Lock()
+	defer b.life.mu.Unlock()
+	return b.life.running
 }
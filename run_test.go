@@ -0,0 +1,83 @@
+package keybasebot
+
+import (
+	"testing"
+	"time"
+
+	"samhofi.us/x/keybase/v2"
+	"samhofi.us/x/keybase/v2/types/chat1"
+)
+
+func TestCtxBeforeRun(t *testing.T) {
+	b := &Bot{life: newLifecycle()}
+	ctx := b.Ctx()
+	b.Shutdown()
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("context from before Run was not cancelled by Shutdown")
+	}
+	if ctx := b.life.start(); ctx.Err() != nil {
+		t.Error("start after Shutdown returned a cancelled context")
+	}
+}
+
+func TestLifecycleGate(t *testing.T) {
+	tests := []struct {
+		name    string
+		running bool
+		want    int
+	}{
+		{"running", true, 1},
+		{"stopped", false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newLifecycle()
+			if tt.running {
+				l.start()
+			}
+			var calls int
+			chat := func(chat1.MsgSummary) { calls++ }
+			h := l.gate(keybase.Handlers{ChatHandler: &chat})
+			(*h.ChatHandler)(chat1.MsgSummary{})
+			if calls != tt.want {
+				t.Errorf("handler ran %d times, want %d", calls, tt.want)
+			}
+		})
+	}
+}
+
+func TestLifecycleStopWaits(t *testing.T) {
+	l := newLifecycle()
+	l.start()
+
+	var (
+		entered = make(chan struct{})
+		release = make(chan struct{})
+		stopped = make(chan struct{})
+	)
+	chat := func(chat1.MsgSummary) {
+		close(entered)
+		<-release
+	}
+	h := l.gate(keybase.Handlers{ChatHandler: &chat})
+	go (*h.ChatHandler)(chat1.MsgSummary{})
+	<-entered
+
+	go func() {
+		l.stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		t.Fatal("stop returned while a handler was running")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("stop did not return after the handler finished")
+	}
+}
@@ -0,0 +1,341 @@
+package keybasebot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kf5grd/keybasebot/pkg/kvstore"
+	"samhofi.us/x/keybase/v2"
+	"samhofi.us/x/keybase/v2/types/chat1"
+)
+
+// DefaultStateNamespace is the kvstore namespace used by a KVStateStore when no namespace is
+// given
+const DefaultStateNamespace = "keybasebot-state"
+
+// DefaultStateSweepInterval is how often expired values are removed from a StateStore that
+// implements StateSweeper
+const DefaultStateSweepInterval = 10 * time.Minute
+
+// Scope determines who a value in the State is shared between
+type Scope int
+
+// These constants represent the available Scopes
+const (
+	// ScopeGlobal values are shared by every conversation and user
+	ScopeGlobal Scope = iota
+
+	// ScopeTeam values are shared by every channel in a team. In conversations that aren't
+	// part of a team, this behaves like ScopeConv
+	ScopeTeam
+
+	// ScopeConv values are shared by everyone in a conversation
+	ScopeConv
+
+	// ScopeUser values belong to a single user, regardless of conversation
+	ScopeUser
+
+	// ScopeUserConv values belong to a single user in a single conversation
+	ScopeUserConv
+)
+
+// scopeMap allows for a lookup of a Scope's string representation
+var scopeMap = map[Scope]string{
+	ScopeGlobal:   "global",
+	ScopeTeam:     "team",
+	ScopeConv:     "conv",
+	ScopeUser:     "user",
+	ScopeUserConv: "userconv",
+}
+
+// String returns a string representation of a Scope
+func (s Scope) String() string {
+	if str, ok := scopeMap[s]; ok {
+		return str
+	}
+	return "unknown"
+}
+
+// StateStore is where a State keeps its values. Values are already encoded when they reach
+// the StateStore, and a StateStore must be safe for concurrent use
+type StateStore interface {
+	// Get returns the value stored under key. If there is no value, or it has expired, ok
+	// is false
+	Get(key string) (value []byte, ok bool, err error)
+
+	// Set stores a value under key. If expires is not the zero time, the value should not
+	// be returned by Get after that time
+	Set(key string, value []byte, expires time.Time) error
+
+	// Delete removes the value stored under key
+	Delete(key string) error
+}
+
+// State holds values that are scoped to a team, conversation, user, or user in a
+// conversation, and is safe for concurrent use. Values are marshaled to and from JSON
+type State struct {
+	Store StateStore
+}
+
+// NewState returns a new State that keeps its values in the given StateStore
+func NewState(store StateStore) *State {
+	return &State{Store: store}
+}
+
+// stateKey returns the key a value is stored under for a given scope
+func stateKey(scope Scope, m chat1.MsgSummary, key string) (string, error) {
+	user := strings.ToLower(m.Sender.Username)
+	switch scope {
+	case ScopeGlobal:
+		return fmt.Sprintf("global/%s", key), nil
+	case ScopeTeam:
+		if m.Channel.MembersType == keybase.TEAM {
+			return fmt.Sprintf("team/%s/%s", strings.ToLower(m.Channel.Name), key), nil
+		}
+		return fmt.Sprintf("conv/%s/%s", m.ConvID, key), nil
+	case ScopeConv:
+		return fmt.Sprintf("conv/%s/%s", m.ConvID, key), nil
+	case ScopeUser:
+		return fmt.Sprintf("user/%s/%s", user, key), nil
+	case ScopeUserConv:
+		return fmt.Sprintf("userconv/%s/%s/%s", m.ConvID, user, key), nil
+	}
+	return "", fmt.Errorf("unknown scope %d", scope)
+}
+
+// Get fetches the value stored under key in the given scope, and unmarshals it into value,
+// which must be a pointer. The message is used to determine which team, conversation, and
+// user the scope refers to. If there is no value, false is returned and value is left
+// untouched
+func (s *State) Get(scope Scope, m chat1.MsgSummary, key string, value interface{}) (bool, error) {
+	k, err := stateKey(scope, m, key)
+	if err != nil {
+		return false, err
+	}
+	data, ok, err := s.Store.Get(k)
+	if err != nil || !ok {
+		return false, err
+	}
+	if err := json.Unmarshal(data, value); err != nil {
+		return false, fmt.Errorf("unable to unmarshal state value '%s': %w", k, err)
+	}
+	return true, nil
+}
+
+// Set stores a value under key in the given scope. If ttl is greater than zero, the value
+// will expire after that amount of time
+func (s *State) Set(scope Scope, m chat1.MsgSummary, key string, value interface{}, ttl time.Duration) error {
+	k, err := stateKey(scope, m, key)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("unable to marshal state value '%s': %w", k, err)
+	}
+	var expires time.Time
+	if ttl > 0 {
+		expires = time.Now().Add(ttl)
+	}
+	return s.Store.Set(k, data, expires)
+}
+
+// Delete removes the value stored under key in the given scope
+func (s *State) Delete(scope Scope, m chat1.MsgSummary, key string) error {
+	k, err := stateKey(scope, m, key)
+	if err != nil {
+		return err
+	}
+	return s.Store.Delete(k)
+}
+
+// StateSweeper is implemented by StateStores that can remove all of their expired values at
+// once. While the bot is running, stores that implement StateSweeper are swept every
+// Bot.StateSweepInterval, so values that expire without ever being read again don't pile up
+type StateSweeper interface {
+	Sweep() error
+}
+
+// sweepState sweeps the State's store every StateSweepInterval until ctx is cancelled
+func (b *Bot) sweepState(ctx context.Context) {
+	if b.State == nil || b.StateSweepInterval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(b.StateSweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			sweeper, ok := b.State.Store.(StateSweeper)
+			if !ok {
+				continue
+			}
+			if err := sweeper.Sweep(); err != nil {
+				b.Logger.Warn("Unable to remove expired state values: %v", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// stateEntry holds a single value in a StateStore along with its expiration
+type stateEntry struct {
+	Value   json.RawMessage `json:"value"`
+	Expires time.Time       `json:"expires,omitempty"`
+}
+
+func (e stateEntry) expired() bool {
+	return !e.Expires.IsZero() && time.Now().After(e.Expires)
+}
+
+// MemoryStateStore is a StateStore that keeps values in memory. Values are lost when the bot
+// exits
+type MemoryStateStore struct {
+	mu     sync.RWMutex
+	values map[string]stateEntry
+}
+
+// NewMemoryStateStore returns a new MemoryStateStore
+func NewMemoryStateStore() *MemoryStateStore {
+	return &MemoryStateStore{
+		values: make(map[string]stateEntry),
+	}
+}
+
+// Get returns the value stored under key
+func (s *MemoryStateStore) Get(key string) ([]byte, bool, error) {
+	s.mu.RLock()
+	e, ok := s.values[key]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, false, nil
+	}
+	if e.expired() {
+		// the value may have been replaced since we looked at it, so check it again before
+		// deleting it
+		s.mu.Lock()
+		if e, ok := s.values[key]; ok && e.expired() {
+			delete(s.values, key)
+		}
+		s.mu.Unlock()
+		return nil, false, nil
+	}
+	return e.Value, true, nil
+}
+
+// Sweep removes every expired value
+func (s *MemoryStateStore) Sweep() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, e := range s.values {
+		if e.expired() {
+			delete(s.values, key)
+		}
+	}
+	return nil
+}
+
+// Set stores a value under key
+func (s *MemoryStateStore) Set(key string, value []byte, expires time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.values[key] = stateEntry{Value: value, Expires: expires}
+	return nil
+}
+
+// Delete removes the value stored under key
+func (s *MemoryStateStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.values, key)
+	return nil
+}
+
+// KVStateStore is a StateStore that keeps values in the Keybase kvstore, so they survive
+// restarts. Expired values are removed the next time they're read, or when the store is
+// swept
+type KVStateStore struct {
+	KB        *keybase.Keybase
+	Team      string
+	Namespace string
+}
+
+// NewKVStateStore returns a new KVStateStore. If team is empty, the bot's implicit
+// self-team is used. If namespace is empty, DefaultStateNamespace is used
+func NewKVStateStore(kb *keybase.Keybase, team, namespace string) *KVStateStore {
+	if namespace == "" {
+		namespace = DefaultStateNamespace
+	}
+	return &KVStateStore{
+		KB:        kb,
+		Team:      team,
+		Namespace: namespace,
+	}
+}
+
+// Get returns the value stored under key
+func (s *KVStateStore) Get(key string) ([]byte, bool, error) {
+	var e stateEntry
+	revision, err := kvstore.GetWithRevision(s.KB, s.Team, s.Namespace, &kvstore.KV{Key: key, Value: &e})
+	if err == kvstore.ErrNotFound {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if e.expired() {
+		s.deleteExpired(key, revision)
+		return nil, false, nil
+	}
+	return e.Value, true, nil
+}
+
+// deleteExpired deletes an expired value, as long as it hasn't been replaced since it was
+// read at the given revision
+func (s *KVStateStore) deleteExpired(key string, revision int) error {
+	err := kvstore.Delete(s.KB, s.Team, s.Namespace, kvstore.New(key, nil, revision+1))
+	if kvstore.IsConflict(err) {
+		return nil
+	}
+	return err
+}
+
+// Sweep removes every expired value
+func (s *KVStateStore) Sweep() error {
+	keys, err := kvstore.Keys(s.KB, s.Team, s.Namespace)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		var e stateEntry
+		revision, err := kvstore.GetWithRevision(s.KB, s.Team, s.Namespace, &kvstore.KV{Key: key, Value: &e})
+		if err == kvstore.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if !e.expired() {
+			continue
+		}
+		if err := s.deleteExpired(key, revision); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Set stores a value under key
+func (s *KVStateStore) Set(key string, value []byte, expires time.Time) error {
+	return kvstore.Put(s.KB, s.Team, s.Namespace, kvstore.New(key, stateEntry{Value: value, Expires: expires}, -1))
+}
+
+// Delete removes the value stored under key
+func (s *KVStateStore) Delete(key string) error {
+	return kvstore.Delete(s.KB, s.Team, s.Namespace, kvstore.New(key, nil, -1))
+}
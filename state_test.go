@@ -0,0 +1,52 @@
+package keybasebot
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemoryStateStoreExpiry(t *testing.T) {
+	s := NewMemoryStateStore()
+	past := time.Now().Add(-time.Minute)
+	future := time.Now().Add(time.Hour)
+
+	s.Set("expired", []byte(`1`), past)
+	s.Set("fresh", []byte(`2`), future)
+	s.Set("forever", []byte(`3`), time.Time{})
+
+	tests := []struct {
+		key  string
+		want string
+		ok   bool
+	}{
+		{"expired", "", false},
+		{"fresh", "2", true},
+		{"forever", "3", true},
+		{"missing", "", false},
+	}
+	for _, tt := range tests {
+		got, ok, err := s.Get(tt.key)
+		if err != nil {
+			t.Fatalf("Get(%q) returned error: %v", tt.key, err)
+		}
+		if ok != tt.ok || string(got) != tt.want {
+			t.Errorf("Get(%q) = %q, %v, want %q, %v", tt.key, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestMemoryStateStoreSweep(t *testing.T) {
+	s := NewMemoryStateStore()
+	s.Set("a", []byte(`1`), time.Now().Add(-time.Second))
+	s.Set("b", []byte(`2`), time.Now().Add(-time.Second))
+	s.Set("c", []byte(`3`), time.Now().Add(time.Hour))
+	if err := s.Sweep(); err != nil {
+		t.Fatalf("Sweep returned error: %v", err)
+	}
+	if len(s.values) != 1 {
+		t.Errorf("%d values left after sweep, want 1", len(s.values))
+	}
+	if _, ok := s.values["c"]; !ok {
+		t.Error("sweep removed a value that hasn't expired")
+	}
+}
@@ -0,0 +1,17 @@
+package keybasebot
+
+import (
+	"samhofi.us/x/keybase/v2/types/chat1"
+)
+
+// ReplyTemplate renders the named template from Bot.Templates with the given data, and sends
+// the result as a reply to a message with Bot.Reply. Values inserted into the template are
+// escaped for Keybase markdown, so user input can't change the formatting of the reply or
+// mention anyone
+func (b *Bot) ReplyTemplate(m chat1.MsgSummary, name string, data interface{}) (chat1.SendRes, error) {
+	body, err := b.Templates.Render(name, data)
+	if err != nil {
+		return chat1.SendRes{}, err
+	}
+	return b.Reply(m, "%s", body)
+}
@@ -0,0 +1,87 @@
+package keybasebot
+
+import (
+	"time"
+
+	"github.com/kf5grd/keybasebot/pkg/logr"
+	"samhofi.us/x/keybase/v2/types/chat1"
+)
+
+// invocation holds what the bot knows about a message while it is being handled
+type invocation struct {
+	// The message's trace ID
+	TraceID string
+
+	// The logger for the message. While a command is handling the message, this logs under
+	// the command's name
+	Logger *logr.Logger
+
+	// The command currently handling the message, if there is one
+	Command *BotCommand
+}
+
+// invocation returns what the bot knows about a message that is being handled, or nil if
+// the message isn't being handled
+func (b *Bot) invocation(m chat1.MsgSummary) *invocation {
+	if b.invocations == nil {
+		return nil
+	}
+	inv, ok := b.invocations.Load(msgKey{ConvID: m.ConvID, MsgID: m.Id})
+	if !ok {
+		return nil
+	}
+	return inv.(*invocation)
+}
+
+// TraceID returns the trace ID of a message the bot is handling. Every incoming message gets
+// a new trace ID, which is attached to the log lines it causes, including the logs of the
+// messages the bot sends, so everything that happened because of one message can be found
+// in the logs. TraceID returns an empty string if the message isn't being handled. Use
+// NewJob to hand work off with the trace ID, or pass it to Outbox.Send with WithTraceID
+func (b *Bot) TraceID(m chat1.MsgSummary) string {
+	if inv := b.invocation(m); inv != nil {
+		return inv.TraceID
+	}
+	return ""
+}
+
+// LoggerFor returns the logger to use while handling a message. While a command is handling
+// the message, the logger logs under the command's name, so log levels can be set for a
+// single command and every adapter it uses, and attaches the message's trace ID. Otherwise,
+// Bot.Logger is returned
+func (b *Bot) LoggerFor(m chat1.MsgSummary) *logr.Logger {
+	if inv := b.invocation(m); inv != nil && inv.Logger != nil {
+		return inv.Logger
+	}
+	return b.Logger
+}
+
+// Job is a JobAction along with the trace ID of the message that caused it, so the work it
+// does can be found in the logs next to everything else the message caused
+type Job struct {
+	Action  JobAction
+	TraceID string
+}
+
+// NewJob returns a Job that runs action, with the trace ID of the message being handled
+func (b *Bot) NewJob(m chat1.MsgSummary, action JobAction) Job {
+	return Job{Action: action, TraceID: b.TraceID(m)}
+}
+
+// Run runs the job's action. How long it took, and the error if it failed, are logged with
+// the job's trace ID
+func (j Job) Run(b *Bot) error {
+	logger := b.Logger.WithComponent("job")
+	if j.TraceID != "" {
+		logger = logger.With("trace_id", j.TraceID)
+	}
+	start := time.Now()
+	err := j.Action(b)
+	logger = logger.With("duration", time.Since(start))
+	if err != nil {
+		logger.With("error", err).Error("Job failed: %v", err)
+		return err
+	}
+	logger.Debug("Job finished")
+	return nil
+}
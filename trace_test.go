@@ -0,0 +1,119 @@
+package keybasebot
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"sync"
+	"testing"
+
+	"github.com/kf5grd/keybasebot/pkg/logr"
+	"samhofi.us/x/keybase/v2"
+	"samhofi.us/x/keybase/v2/types/chat1"
+)
+
+func TestInvocationLookup(t *testing.T) {
+	var (
+		b = &Bot{
+			Logger:      logr.New(&bytes.Buffer{}, false, false),
+			invocations: &sync.Map{},
+		}
+		handled   = chat1.MsgSummary{ConvID: "conv", Id: 1}
+		unhandled = chat1.MsgSummary{ConvID: "conv", Id: 2}
+		logger    = b.Logger.With("trace_id", "abc123")
+	)
+	b.invocations.Store(msgKey{ConvID: handled.ConvID, MsgID: handled.Id}, &invocation{TraceID: "abc123", Logger: logger})
+
+	tests := []struct {
+		name       string
+		m          chat1.MsgSummary
+		wantTrace  string
+		wantLogger *logr.Logger
+	}{
+		{"handled", handled, "abc123", logger},
+		{"unhandled", unhandled, "", b.Logger},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := b.TraceID(tt.m); got != tt.wantTrace {
+				t.Errorf("TraceID = %q, want %q", got, tt.wantTrace)
+			}
+			if got := b.LoggerFor(tt.m); got != tt.wantLogger {
+				t.Errorf("LoggerFor returned the wrong logger")
+			}
+		})
+	}
+}
+
+func TestJobRun(t *testing.T) {
+	boom := errors.New("boom")
+	tests := []struct {
+		name      string
+		trace     string
+		err       error
+		wantLevel logr.Level
+	}{
+		{"success", "abc123", nil, logr.LevelDebug},
+		{"failure", "abc123", boom, logr.LevelError},
+		{"no trace", "", boom, logr.LevelError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				logs = logr.NewRingBuffer(10, logr.LevelUnknown)
+				b    = &Bot{Logger: logr.New(ioutil.Discard, true, false)}
+				job  = Job{TraceID: tt.trace, Action: func(*Bot) error { return tt.err }}
+			)
+			b.Logger.Handler = logs
+			if err := job.Run(b); err != tt.err {
+				t.Errorf("Run returned %v, want %v", err, tt.err)
+			}
+			msgs := logs.Messages()
+			if len(msgs) != 1 {
+				t.Fatalf("logged %d messages, want 1", len(msgs))
+			}
+			if got := msgs[0].LevelValue(); got != tt.wantLevel {
+				t.Errorf("logged at %s, want %s", got, tt.wantLevel)
+			}
+			if got, _ := msgs[0].Fields["trace_id"].(string); got != tt.trace {
+				t.Errorf("trace_id = %q, want %q", got, tt.trace)
+			}
+		})
+	}
+}
+
+func TestHelpersLogWithTrace(t *testing.T) {
+	var (
+		b    = New("test")
+		logs = logr.NewRingBuffer(10, logr.LevelUnknown)
+		m    = chat1.MsgSummary{ConvID: "conv", Id: 1}
+	)
+	b.Logger = logr.New(ioutil.Discard, false, false)
+	b.Logger.MinLevel = logr.LevelDebug
+	b.Logger.Handler = logs
+	b.invocations.Store(msgKey{ConvID: m.ConvID, MsgID: m.Id}, &invocation{
+		TraceID: "abc123",
+		Logger:  b.Logger.With("trace_id", "abc123"),
+	})
+
+	// a cached message and a conversation that doesn't allow exploding messages keep both
+	// helpers from calling the Keybase service
+	b.parents.put(msgKey{ConvID: m.ConvID, MsgID: 2}, chat1.MsgSummary{ConvID: m.ConvID, Id: 2})
+	b.noExplode.Store(m.ConvID, struct{}{})
+	if _, err := b.fetchMessage(b.LoggerFor(m), m.ConvID, 2); err != nil {
+		t.Fatalf("fetchMessage returned error: %v", err)
+	}
+	if _, err := b.sendExploding(m, m.ConvID, "reply", keybase.SendMessageOptions{}, nil); err != ErrExplodingNotAllowed {
+		t.Fatalf("sendExploding returned %v, want %v", err, ErrExplodingNotAllowed)
+	}
+
+	msgs := logs.Messages()
+	if len(msgs) != 2 {
+		t.Fatalf("logged %d messages, want 2", len(msgs))
+	}
+	for _, msg := range msgs {
+		if got, _ := msg.Fields["trace_id"].(string); got != "abc123" {
+			t.Errorf("%q was logged with trace_id %q, want %q", msg.Message, got, "abc123")
+		}
+	}
+}
@@ -1,11 +1,14 @@
 package keybasebot
 
 import (
-	"fmt"
 	"io"
 	"os"
+	"sync"
+	"time"
 
 	"github.com/kf5grd/keybasebot/pkg/logr"
+	"github.com/kf5grd/keybasebot/pkg/render"
+	"github.com/kf5grd/keybasebot/pkg/util"
 	"samhofi.us/x/keybase/v2"
 	"samhofi.us/x/keybase/v2/types/chat1"
 )
@@ -14,7 +17,8 @@ import (
 // return is true, the bot will not attempt to execute any other commands after this one.
 // If an error is returned, it will be sent to the logger. If an error is returned and the
 // boolean is also set to true, the returned error will be sent back to the chat as a reply
-// to the message that triggered the command.
+// to the message that triggered the command. Return a UserError to control which part of
+// the error is shown in the chat.
 type BotAction func(chat1.MsgSummary, *Bot) (bool, error)
 
 // BotCommand holds information regarding a command and its advertisements
@@ -46,12 +50,30 @@ type BotCommand struct {
 
 	// The function to run when the command is triggered
 	Run BotAction
+
+	// Handle can be used instead of Run when you want to return a Result, which says more
+	// precisely what the command did with the message. If Handle is set, Run is ignored
+	Handle ResultAction
+
+	// Setting this to true causes the replies and reactions this command sent with
+	// Bot.Reply and Bot.React to be deleted when the message that triggered the command is
+	// deleted. See Bot.ReplyTrackingWindow for how long replies are remembered
+	RetractOnDelete bool
+
+	// If Ephemeral is greater than zero, replies this command sends with Bot.Reply,
+	// Bot.StartProgress, and Context.ReplyPrivately will be exploding messages with this
+	// lifetime, and so will error replies. The ExplodingErrors adapter is only needed to give
+	// error replies a different lifetime, or to make them explode when this isn't set.
+	// Attachments can't explode, so Bot.ReplyFile and Context.Upload refuse to upload them
+	// unless Bot.EphemeralFallback is set
+	Ephemeral time.Duration
 }
 
 // Adapter can modify the behavior of a BotAction
 type Adapter func(BotAction) BotAction
 
-// JobAction is a function that can be run by the JobQueue
+// JobAction is a function that can be run by the JobQueue. Wrap it in a Job to keep the
+// trace ID of the message that caused it
 type JobAction func(b *Bot) error
 
 // Bot is where we'll hold the necessary information for the bot to run
@@ -78,12 +100,48 @@ type Bot struct {
 	// the LogWriter
 	LogConv chat1.ConvIDStr
 
+	// The lowest level of log message to send to LogConv. This can only raise the level set
+	// by LogLevel and LogLevels, not lower it. If this is left as logr.LevelUnknown,
+	// logr.LevelInfo is used, so turning on Debug doesn't flood the conversation
+	LogConvLevel logr.Level
+
+	// How often buffered log messages are sent to LogConv. Messages are collected into a
+	// single code block, and sent early if the buffer fills up
+	LogConvInterval time.Duration
+
+	// The most messages that will be sent to LogConv in one minute. Log lines that would go
+	// over the limit are dropped, and the number dropped is noted in the next message
+	LogConvMaxPerMinute int
+
+	// Removes sensitive values from log messages before they're written anywhere, including
+	// LogConv. Use logr.NewRedactor to create one, and register your config's secrets with
+	// AddSecret
+	LogRedactor *logr.Redactor
+
+	// Setting this to true replaces usernames and conversation IDs in log messages with a
+	// salted hash, so messages from the same user or conversation can still be matched up.
+	// A LogRedactor is created if one isn't set
+	HashLogIdentities bool
+
+	// Additional places to send log messages, each with its own level and format. These
+	// receive every message that passes LogLevel and LogLevels
+	LogHandlers []logr.Handler
+
 	// Whether log messages should be in JSON format
 	JSON bool
 
 	// Whether to show debug messages in log output
 	Debug bool
 
+	// The lowest level of log message to write. If this is left as logr.LevelUnknown,
+	// logr.LevelInfo is used, or logr.LevelDebug if Debug is true
+	LogLevel logr.Level
+
+	// Per-component overrides for LogLevel. Each command logs under its Name (see
+	// Bot.LoggerFor), so you can turn on debug messages for a single command (including the
+	// adapters it uses) with something like map[string]logr.Level{"Deploy": logr.LevelDebug}
+	LogLevels map[string]logr.Level
+
 	// Message handlers. You probably should leave the Chat handler alone
 	Handlers keybase.Handlers
 
@@ -93,17 +151,142 @@ type Bot struct {
 	// A slice holding all of you BotCommands. Be sure to populate this prior to calling Run()
 	Commands []BotCommand
 
-	// You can use this to store custom info in order to pass it around to your bot commands
+	// A slice holding all of your Dialogs, which can be started from a command with
+	// Bot.StartDialog. Be sure to populate this prior to calling Run()
+	Dialogs []Dialog
+
+	// Setting this to true causes pending dialogs to be stored in the kvstore, so they can
+	// be resumed if the bot is restarted
+	PersistDialogs bool
+
+	// The team whose kvstore holds pending dialogs when PersistDialogs is true. Leave this
+	// empty to use the bot's implicit self-team
+	DialogTeam string
+
+	// The kvstore namespace that holds pending dialogs when PersistDialogs is true
+	DialogNamespace string
+
+	// You can use this to store custom info in order to pass it around to your bot commands.
+	// Note that Meta is shared by every command and conversation, and is not safe for
+	// concurrent use. Prefer State for anything that is written while the bot is running
 	Meta map[string]interface{}
 
+	// State holds values scoped to a team, conversation, user, or user in a conversation,
+	// and is safe for concurrent use. By default values are kept in memory, but you can
+	// replace the store with a KVStateStore to keep them in the Keybase kvstore
+	State *State
+
+	// How often expired values are removed from the State's store, if the store implements
+	// StateSweeper. Set this to zero to disable sweeping
+	StateSweepInterval time.Duration
+
 	// Setting this to true allows the bot to react to its own messages. You'll need to be
 	// careful with your commands when enabling this to make sure your bot doesn't get stuck
 	// in a loop attempting to verify its own message, then sending an error, then trying to
 	// verify, etc.
 	AllowSelfMessages bool
 
-	// Indicates whether the bot is currently running or not
-	running bool
+	// Setting this to true causes edited messages to be handled as if they were new text
+	// messages, so a user can fix a typo in a command and have it run again. The rewritten
+	// message keeps the ID of the original message, and when a command replies with
+	// Bot.Reply, the bot's previous reply to the original message is edited instead of a
+	// new reply being sent
+	HandleEdits bool
+
+	// How long the bot remembers which replies it sent in response to which messages. This
+	// limits how long edited messages can update the bot's replies, and how long deleting a
+	// message will retract the replies of commands that have RetractOnDelete set. This must
+	// be set before calling Run()
+	ReplyTrackingWindow time.Duration
+
+	// The directory that attachments are downloaded to by the Attachment adapter. If this is
+	// empty, the system's default temp directory is used
+	TempDir string
+
+	// The team whose kvstore holds the bot's permission groups. Leave this empty to use the
+	// bot's implicit self-team
+	PermissionTeam string
+
+	// The kvstore namespace that holds the bot's permission groups
+	PermissionNamespace string
+
+	// Members of this team with at least the PermissionBootstrapRole are granted every
+	// permission, which allows them to bootstrap the permission groups. This is empty by
+	// default, which disables the fallback
+	PermissionBootstrapTeam string
+
+	// The lowest role in the PermissionBootstrapTeam that is granted every permission. Set
+	// this to an empty string to disable the fallback
+	PermissionBootstrapRole string
+
+	// Templates used by Bot.ReplyTemplate. Add templates with Templates.Parse,
+	// Templates.ParseFiles, or Templates.ParseGlob
+	Templates *render.Renderer
+
+	// Everything the bot sends with Bot.Reply, Bot.React, and the other Bot helpers goes
+	// through the Outbox, which enforces rate limits and retries failed edits and deletes.
+	// You can change its settings before calling Run()
+	Outbox *Outbox
+
+	// Receives measurements from the bot, such as how many messages were sent or failed to
+	// send. Defaults to NopMetrics
+	Metrics Metrics
+
+	// Translations of the messages sent by the framework and your commands, keyed by
+	// locale, such as "en" or "pt-BR". See Bot.T for how messages are looked up
+	Catalogs map[string]Catalog
+
+	// The locale used when neither the user nor the team has chosen one
+	DefaultLocale string
+
+	// The team whose kvstore holds locale settings. Leave this empty to use the bot's
+	// implicit self-team
+	LocaleTeam string
+
+	// The kvstore namespace that holds locale settings
+	LocaleNamespace string
+
+	// Setting this to true sends a normal, permanent message when an exploding message
+	// can't be sent because the conversation doesn't allow them. By default,
+	// ErrExplodingNotAllowed is returned instead, so nothing meant to disappear is kept
+	EphemeralFallback bool
+
+	// Causes errors that aren't UserErrors to be replaced with a generic message when
+	// they're sent back to the chat, so internal details don't leak. The full error is still
+	// logged. This is true by default; set it to false to send errors to the chat as they are
+	HideInternalErrors bool
+
+	// Setting this to true adds a short correlation ID to every error that is sent back to
+	// the chat, so users can report it. For errors caused by an incoming message, this is the
+	// message's trace ID, which can be used to find every log line the message produced
+	ErrorIDs bool
+
+	// Holds the bot's context and whether it is running
+	life *lifecycle
+
+	// Keeps track of the bot's replies to incoming messages
+	replies *replyTracker
+
+	// Holds messages that have been fetched because they were replied to
+	parents *messageCache
+
+	// Holds the paths of attachments downloaded by the Attachment adapter
+	downloads *sync.Map
+
+	// Keeps track of dialogs that are waiting for an answer
+	dialogs *dialogManager
+
+	// Holds locale settings that have been read from the kvstore
+	locales *sync.Map
+
+	// Holds the command currently handling each message
+	invocations *sync.Map
+
+	// Holds the conversations where exploding messages aren't allowed
+	noExplode *sync.Map
+
+	// Sends log messages to LogConv, if it's set
+	logConv *convHandler
 }
 
 // New returns a new Bot instance. name will set the Bot.Name and will show up next to the
@@ -117,6 +300,31 @@ func New(name string, opts ...keybase.KeybaseOpt) *Bot {
 	b.Opts = keybase.RunOptions{}
 	b.Commands = make([]BotCommand, 0)
 	b.Meta = make(map[string]interface{})
+	b.LogLevels = make(map[string]logr.Level)
+	b.LogConvInterval = DefaultLogConvInterval
+	b.LogConvMaxPerMinute = DefaultLogConvMaxPerMinute
+	b.State = NewState(NewMemoryStateStore())
+	b.StateSweepInterval = DefaultStateSweepInterval
+	b.PermissionNamespace = DefaultPermissionNamespace
+	b.PermissionBootstrapRole = util.RoleOwner
+	b.ReplyTrackingWindow = DefaultReplyTrackingWindow
+	b.replies = newReplyTracker(defaultMaxTrackedMessages, b.ReplyTrackingWindow)
+	b.parents = newMessageCache(defaultMaxCachedParents)
+	b.downloads = &sync.Map{}
+	b.Dialogs = make([]Dialog, 0)
+	b.DialogNamespace = DefaultDialogNamespace
+	b.dialogs = newDialogManager()
+	b.Templates = render.New()
+	b.Outbox = newOutbox(&b)
+	b.Metrics = NopMetrics{}
+	b.Catalogs = make(map[string]Catalog)
+	b.DefaultLocale = DefaultLocale
+	b.HideInternalErrors = true
+	b.LocaleNamespace = DefaultLocaleNamespace
+	b.locales = &sync.Map{}
+	b.invocations = &sync.Map{}
+	b.noExplode = &sync.Map{}
+	b.life = newLifecycle()
 
 	// Implement a default logger that logs to stdout with debug enabled and json disabled.
 	// This will get replaced with the user's configured logger when bot.Run() is called.
@@ -125,26 +333,3 @@ func New(name string, opts ...keybase.KeybaseOpt) *Bot {
 
 	return &b
 }
-
-// We'll use this to create a writer for the Logger which will be able to write logs to
-// stdout, and optionally also to a Keybase chat conversation
-type convWriter struct {
-	ConvID chat1.ConvIDStr
-	Writer io.Writer
-	KB     *keybase.Keybase
-}
-
-// Write sends log message strings to a channel
-func (cw convWriter) Write(p []byte) (n int, err error) {
-	if cw.ConvID != "" {
-		opts := keybase.SendMessageOptions{
-			ConversationID: cw.ConvID,
-			NonBlock:       true,
-			Message:        keybase.SendMessageBody{Body: string(p)},
-		}
-		cw.KB.SendMessage("send", opts)
-	}
-
-	fmt.Fprintf(cw.Writer, string(p))
-	return len(p), nil
-}